@@ -1,16 +1,20 @@
 package api
 
 import (
+	"crypto/ed25519"
+
 	"github.com/gorilla/mux"
 	"github.com/rainbowmga/timetravel/service"
 )
 
+// auditKey signs audit exports, which are unavailable without it.
 type API struct {
-	records service.RecordService
+	records  service.RecordService
+	auditKey ed25519.PrivateKey
 }
 
-func NewAPI(records service.RecordService) *API {
-	return &API{records}
+func NewAPI(records service.RecordService, auditKey ed25519.PrivateKey) *API {
+	return &API{records, auditKey}
 }
 
 // generates all api routes
@@ -20,7 +24,19 @@ func (a *API) CreateRoutes(routes *mux.Router) {
 }
 
 func (a *API) CreateRoutesV2(routes *mux.Router) {
+	routes.Path("/records").HandlerFunc(a.ListRecords).Methods("GET")
+	routes.Path("/records:batchGet").HandlerFunc(a.BatchGetRecords).Methods("POST")
+	routes.Path("/records/{id}").HandlerFunc(a.GetRecordAsOf).Methods("GET")
 	routes.Path("/records/{id}/versions").HandlerFunc(a.GetRecordVersions).Methods("GET")
+	routes.Path("/records/{id}/diff").HandlerFunc(a.GetRecordDiff).Methods("GET")
+	routes.Path("/records/{id}/verify").HandlerFunc(a.GetRecordVerify).Methods("GET")
+	routes.Path("/records/{id}/audit-export").HandlerFunc(a.GetAuditExport).Methods("GET")
+	routes.Path("/records/{id}/fields/{key}/history").HandlerFunc(a.GetFieldHistory).Methods("GET")
 	routes.Path("/records/{id}/version/{versionId}").HandlerFunc(a.GetVersionedRecord).Methods("GET")
+	routes.Path("/records/{id}/version/{versionId}/retract").HandlerFunc(a.PostVersionRetract).Methods("POST")
 	routes.Path("/records/{id}").HandlerFunc(a.PostRecordsAtAGivenTime).Methods("POST")
+	routes.Path("/records/{id}/revert").HandlerFunc(a.PostRecordRevert).Methods("POST")
+	routes.Path("/records/{id}").HandlerFunc(a.DeleteRecord).Methods("DELETE")
+	routes.Path("/records/{id}/undelete").HandlerFunc(a.UndeleteRecord).Methods("POST")
+	routes.Path("/transactions").HandlerFunc(a.PostTransaction).Methods("POST")
 }
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rainbowmga/timetravel/service"
+)
+
+const maxBatchGetSize = 1000
+
+// The records to read in a batch, and the optional effective and knowledge times to read them at, as unix seconds or
+// RFC 3339 timestamps.
+type BatchGetPayload struct {
+	IDs        []int            `json:"ids"`
+	At         BodyTimestamp    `json:"at"`
+	KnownAt    BodyTimestamp    `json:"knownAt"`
+}
+
+// POST /records:batchGet
+// BatchGetRecords retrieves several records with a single consistent read. The records are read in the state they
+// were in at the effective time at (default now), as known at knownAt (default now).
+func (a *API) BatchGetRecords(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload BatchGetPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		writeRequestProblem(w, http.StatusBadRequest, CodeMalformedRequest, "invalid input; could not parse json")
+		return
+	}
+
+	if len(payload.IDs) == 0 || len(payload.IDs) > maxBatchGetSize {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid input; ids must contain between 1 and 1000 ids")
+		return
+	}
+
+	// A record requested twice is read and returned once.
+	seen := map[int]bool{}
+	ids := []int{}
+	for _, id := range payload.IDs {
+		if id <= 0 {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+			return
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	opts := service.BatchGetOptions{ IDs: ids }
+
+	opts.At, err = parseTimestamp(string(payload.At))
+	if err != nil {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid at; expected unix seconds or an RFC 3339 timestamp")
+		return
+	}
+
+	if payload.KnownAt != "" {
+		opts.KnownAt, err = parseTimestamp(string(payload.KnownAt))
+		if err != nil {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid knownAt; expected unix seconds or an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	batch, err := a.records.BatchGetRecords(ctx, opts)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, batch, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DELETE /records/{id}?effectiveAt={timestamp}
+// DeleteRecord deletes the record from effectiveAt (default now) on. Reads from that point on return not found,
+// while time-travel reads before it still return the record. A delete before the latest version of the record is
+// rejected with 409.
+func (a *API) DeleteRecord(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	effectiveAt, err := parseTimestamp(r.URL.Query().Get("effectiveAt"))
+	if err != nil {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid effectiveAt; expected unix seconds or an RFC 3339 timestamp")
+		return
+	}
+
+	provenance, err := readProvenance(r)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	record, err := a.records.DeleteRecord(ctx, int(idNumber), effectiveAt, provenance)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, record, http.StatusOK)
+	logError(err)
+}
+
+// The optional effective time of an undelete.
+type UndeletePayload struct {
+	UpdatedTimestamp    int64    `json:"updatedTimestamp"`
+}
+
+// POST /records/{id}/undelete
+// UndeleteRecord restores the data the record had before it was deleted, effective at updatedTimestamp (default now).
+func (a *API) UndeleteRecord(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	provenance, err := readProvenance(r)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	// The payload is optional.
+	var payload UndeletePayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && err != io.EOF {
+		writeRequestProblem(w, http.StatusBadRequest, CodeMalformedRequest, "invalid input; could not parse json")
+		return
+	}
+
+	if payload.UpdatedTimestamp == 0 {
+		payload.UpdatedTimestamp = time.Now().Unix()
+	}
+
+	record, err := a.records.UndeleteRecord(ctx, int(idNumber), payload.UpdatedTimestamp, provenance)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, record, http.StatusOK)
+	logError(err)
+}
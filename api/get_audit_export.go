@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// GET /records/{id}/audit-export
+// GetAuditExport exports the full history of the record as a self-contained document signed with the audit key:
+// every version with its effective and reported times and who wrote it, every row ever written for the record,
+// and the hash chain over those rows. The export is checked with the verify-audit command.
+func (a *API) GetAuditExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	if a.auditKey == nil {
+		writeRequestProblem(w, http.StatusServiceUnavailable, CodeUnavailable, "audit exports are unavailable; no signing key is configured")
+		return
+	}
+
+	document, err := a.records.ExportRecord(ctx, int(idNumber))
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	export, err := entity.SignAuditDocument(document, a.auditKey)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, export, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /records/{id}/fields/{key}/history
+// GetFieldHistory retrieves the intervals of effective time during which the attribute held a value.
+func (a *API) GetFieldHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	key := mux.Vars(r)["key"]
+
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	history, err := a.records.GetFieldHistory(ctx, int(idNumber), key)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, history, http.StatusOK)
+	logError(err)
+}
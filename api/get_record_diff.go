@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rainbowmga/timetravel/entity"
+	"github.com/rainbowmga/timetravel/service"
+)
+
+// GET /records/{id}/diff?from={version|timestamp}&to={version|timestamp}
+// GetRecordDiff retrieves the keys that were added, removed and changed between two versions of the record.
+// A version is referenced by its identifier prefixed with "v" (e.g. v3); anything else is read as an effective
+// timestamp, either unix seconds or RFC 3339. to defaults to the version in effect now. A timestamp before the
+// first version of the record is rejected rather than read as a record that did not exist yet.
+// Each change is marked with the kind of the last version that changed its key, so real-world changes can be told
+// apart from corrections.
+func (a *API) GetRecordDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid query; from is required")
+		return
+	}
+
+	from, err := a.resolveRecordRef(ctx, int(idNumber), query.Get("from"))
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	to, err := a.resolveRecordRef(ctx, int(idNumber), query.Get("to"))
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	versions, err := a.records.GetVersions(ctx, int(idNumber))
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	// The versions from the earlier side of the diff to the later one.
+	first, last := from.EffectivePosition, to.EffectivePosition
+	if first > last {
+		first, last = last, first
+	}
+
+	diff := from.Diff(to)
+	if first >= 1 && last <= len(versions) {
+		diff.MarkKinds(versions[first-1:last])
+	}
+
+	err = writeJSON(w, diff, http.StatusOK)
+	logError(err)
+}
+
+// resolveRecordRef reads the version of the record referenced by ref: "v<version>" for a version identifier,
+// otherwise an effective timestamp. An empty ref resolves to the version in effect now. An invalid ref is a
+// validation error, and so is a timestamp before the first version of an existing record, which is most likely a
+// version identifier written without its "v".
+func (a *API) resolveRecordRef(ctx context.Context, id int, ref string) (entity.Record, error) {
+	if strings.HasPrefix(ref, "v") {
+		version, err := strconv.ParseInt(strings.TrimPrefix(ref, "v"), 10, 32)
+		if err != nil || version < 1 {
+			return entity.Record{}, &service.Error{ Kind: service.KindValidation, Code: CodeInvalidVersion, Message: fmt.Sprintf("invalid version reference %q", ref) }
+		}
+		return a.records.GetVersionedRecord(ctx, id, int(version))
+	}
+
+	timestamp, err := parseTimestamp(ref)
+	if err != nil {
+		return entity.Record{}, &service.Error{ Kind: service.KindValidation, Code: CodeInvalidTimestamp, Message: fmt.Sprintf("invalid timestamp reference %q", ref), Err: err }
+	}
+
+	record, err := a.records.GetRecordAt(ctx, id, timestamp)
+	if !errors.Is(err, service.ErrRecordDoesNotExist) || errors.Is(err, service.ErrRecordDeleted) {
+		return record, err
+	}
+
+	versions, errInVersions := a.records.GetVersions(ctx, id)
+	if errInVersions != nil {
+		return entity.Record{}, err
+	}
+
+	message := fmt.Sprintf("invalid timestamp reference %q; it is before the first version of the record, which took effect at %d. A version is referenced by its identifier as v<version>", ref, versions[0].UpdatedTimestamp)
+	if _, errInParsing := strconv.ParseInt(ref, 10, 32); errInParsing == nil {
+		message += fmt.Sprintf("; did you mean v%s?", ref)
+	}
+	return entity.Record{}, &service.Error{ Kind: service.KindValidation, Code: CodeInvalidTimestamp, Message: message }
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /records/{id}/verify
+// GetRecordVerify checks the hash chain over the history of the record, which detects rows that were edited,
+// removed or closed out outside the service. A broken chain is reported in the response, not as an error.
+func (a *API) GetRecordVerify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	verification, err := a.records.VerifyRecord(ctx, int(idNumber))
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, verification, http.StatusOK)
+	logError(err)
+}
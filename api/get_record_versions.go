@@ -14,15 +14,13 @@ func (a *API) GetRecordVersions(w http.ResponseWriter, r *http.Request) {
         idNumber, err := strconv.ParseInt(id, 10, 32)
 
 	if err != nil || idNumber <0 {
-		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
-		logError(err)
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
 		return
 	}
 
 	versionedRecords, err := a.records.GetVersions(ctx, int(idNumber))
 	if err != nil {
-		err2 := writeError(w, fmt.Sprintf("The versions for the record could not be read from the db."), http.StatusBadRequest)
-		logError(err2)
+		writeServiceProblem(w, err)
 		return
 	}
 	
@@ -37,18 +35,22 @@ func (a *API) GetVersionedRecord(w http.ResponseWriter, r *http.Request) {
 	versionId := mux.Vars(r)["versionId"]
 
 	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
 	versionNumber, err := strconv.ParseInt(versionId, 10, 32)
 
-	if versionNumber < 1 {
-		err := writeError(w, fmt.Sprintf("The version needs to be greater than 0, input was  %v", versionNumber), http.StatusBadRequest)
-		logError(err)
+	if err != nil {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidVersion, fmt.Sprintf("The version needs to be a number greater than 0, input was %v", versionId))
 		return
 	}
 	
 	versionedRecord, err := a.records.GetVersionedRecord(ctx, int(idNumber), int(versionNumber))
 	if err != nil {
-		err := writeError(w, fmt.Sprintf("The versioned record could be read from the db"), http.StatusBadRequest)
-		logError(err)
+		writeServiceProblem(w, err)
 		return
 	}
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"github.com/gorilla/mux"
+	"github.com/rainbowmga/timetravel/entity"
 )
 
 // GET /records/{id}
@@ -25,6 +26,10 @@ func (a *API) GetRecords(w http.ResponseWriter, r *http.Request) {
 		ctx,
 		int(idNumber),
 	)
+	if writeCancelled(w, err) {
+		return
+	}
+
 	if err != nil {
 		err := writeError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
 		logError(err)
@@ -34,6 +39,64 @@ func (a *API) GetRecords(w http.ResponseWriter, r *http.Request) {
 	// Transform the Record to the signature of Record in V1
 	recordToReturn := record.GetRecordV1()
 
+	w.Header().Set("ETag", etag(record.Revision))
 	err = writeJSON(w, recordToReturn, http.StatusOK)
 	logError(err)
 }
+
+// GET /records/{id}?at={timestamp}
+// GET /records/{id}?effectiveAt={timestamp}&knownAt={timestamp}
+// GetRecordAsOf retrieves the state of the record effective at effectiveAt, as it was known at knownAt.
+// at is shorthand for effectiveAt. Both timestamps are optional and default to now.
+func (a *API) GetRecordAsOf(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	query := r.URL.Query()
+
+	if query.Has("at") && query.Has("effectiveAt") {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid query; at and effectiveAt cannot be used together")
+		return
+	}
+
+	effectiveAtParam := query.Get("effectiveAt")
+	if query.Has("at") {
+		effectiveAtParam = query.Get("at")
+	}
+
+	effectiveAt, err := parseTimestamp(effectiveAtParam)
+	if err != nil {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid effective time; expected unix seconds or an RFC 3339 timestamp")
+		return
+	}
+
+	var record entity.Record
+	if query.Has("knownAt") {
+		var knownAt int64
+		knownAt, err = parseTimestamp(query.Get("knownAt"))
+		if err != nil {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid knownAt; expected unix seconds or an RFC 3339 timestamp")
+			return
+		}
+
+		record, err = a.records.GetRecordAsOf(ctx, int(idNumber), effectiveAt, knownAt)
+	} else {
+		record, err = a.records.GetRecordAt(ctx, int(idNumber), effectiveAt)
+	}
+
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(record.Revision))
+	err = writeJSON(w, record, http.StatusOK)
+	logError(err)
+}
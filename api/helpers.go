@@ -1,16 +1,31 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+	"github.com/rainbowmga/timetravel/service"
 )
 
 var (
 	ErrInternal = errors.New("internal error")
 )
 
+const maxIdempotencyKeyLength = 255
+
+// statusClientClosedRequest is the non-standard status of a request the client abandoned before the response.
+const statusClientClosedRequest = 499
+
 // logs an error if it's not nil
 func logError(err error) {
 	if err != nil {
@@ -35,3 +50,122 @@ func writeError(w http.ResponseWriter, message string, statusCode int) error {
 		statusCode,
 	)
 }
+
+// writeCancelled answers a request whose database work was cancelled, and reports whether err was such a
+// cancellation. A request that ran past its deadline gets 504; a request the client abandoned gets 499.
+func writeCancelled(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, service.ErrCancelled) {
+		return false
+	}
+
+	status := statusClientClosedRequest
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	errInWriting := writeError(w, err.Error(), status)
+	logError(errInWriting)
+	return true
+}
+
+// requestHash hashes everything that decides what a write does: its method and path, which also tell the v1 and v2
+// endpoints apart, its onConflict policy, its If-Match header, the provenance headers stored with the versions it
+// writes and its body. The hash identifies the request when it is retried with the same idempotency key. Each part
+// is prefixed with its length, so parts cannot run into each other.
+func requestHash(r *http.Request, body []byte) string {
+	parts := []string{
+		r.Method, r.URL.Path, r.URL.Query().Get("onConflict"), r.Header.Get("If-Match"),
+		r.Header.Get("X-Authenticated-User"), r.Header.Get("X-Source-Channel"), r.Header.Get("X-Change-Reason"),
+		string(body),
+	}
+
+	hash := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// readProvenance reads who is making a write and why: the authenticated user in X-Authenticated-User, which is set
+// by the authenticating proxy, the channel in X-Source-Channel and a free-text reason in X-Change-Reason.
+// An unknown channel is a validation error.
+func readProvenance(r *http.Request) (entity.Provenance, error) {
+	provenance := entity.Provenance{
+		Actor: r.Header.Get("X-Authenticated-User"),
+		Source: r.Header.Get("X-Source-Channel"),
+		Reason: r.Header.Get("X-Change-Reason"),
+	}
+
+	if !entity.ValidSource(provenance.Source) {
+		return provenance, &service.Error{ Kind: service.KindValidation, Code: "invalid_source", Message: "invalid X-Source-Channel; expected one of portal, email_intake or underwriter" }
+	}
+	return provenance, nil
+}
+
+// etag formats the revision of a record as a strong entity tag.
+func etag(revision int) string {
+	return strconv.Quote(strconv.Itoa(revision))
+}
+
+// parseIfMatch parses an If-Match header into the revisions it accepts. A nil result means the header is absent,
+// and an empty result that it is "*", which matches any existing record. Tags that are not the tag of a revision,
+// including weak tags, never match.
+func parseIfMatch(header string) []int {
+	if header == "" {
+		return nil
+	}
+
+	revisions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return []int{}
+		}
+
+		revision := -1
+		if unquoted, err := strconv.Unquote(tag); err == nil && strings.HasPrefix(tag, `"`) {
+			if parsed, err := strconv.Atoi(unquoted); err == nil {
+				revision = parsed
+			}
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions
+}
+
+// A timestamp in a request body: unix seconds as a number, or a string that parseTimestamp accepts.
+type BodyTimestamp string
+
+// Method to read the timestamp from a json number or string.
+func (t *BodyTimestamp) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*t = BodyTimestamp(number)
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*t = BodyTimestamp(value)
+	return nil
+}
+
+// parseTimestamp parses a query timestamp given either as unix seconds or as an RFC 3339 string.
+// An empty value defaults to now.
+func parseTimestamp(value string) (int64, error) {
+	if value == "" {
+		return time.Now().Unix(), nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return parsed.Unix(), nil
+}
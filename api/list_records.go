@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rainbowmga/timetravel/service"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// GET /records?limit={n}&cursor={cursor}&where[{key}]={value}&at={timestamp}
+// ListRecords retrieves a page of the records in the state they were in at the effective time at (default now),
+// keeping only the records whose attributes match every where[key]=value filter.
+func (a *API) ListRecords(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	opts := service.ListOptions{ Limit: defaultListLimit, Where: map[string]string{} }
+
+	if limit := query.Get("limit"); limit != "" {
+		limitNumber, err := strconv.Atoi(limit)
+		if err != nil || limitNumber <= 0 || limitNumber > maxListLimit {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid limit; limit must be a number between 1 and 500")
+			return
+		}
+		opts.Limit = limitNumber
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		cursorNumber, err := strconv.Atoi(cursor)
+		if err != nil || cursorNumber < 0 {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid cursor")
+			return
+		}
+		opts.Cursor = cursorNumber
+	}
+
+	at, err := parseTimestamp(query.Get("at"))
+	if err != nil {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid at; expected unix seconds or an RFC 3339 timestamp")
+		return
+	}
+	opts.At = at
+
+	for param, values := range query {
+		if !strings.HasPrefix(param, "where[") || !strings.HasSuffix(param, "]") {
+			continue
+		}
+
+		key := strings.TrimSuffix(strings.TrimPrefix(param, "where["), "]")
+		if key == "" || len(values) != 1 {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid filter; expected a single where[key]=value per key")
+			return
+		}
+		opts.Where[key] = values[0]
+	}
+
+	page, err := a.records.ListRecords(ctx, opts)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, page, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// The target of a revert: either a version identifier or an effective timestamp, and the optional effective
+// time of the revert itself.
+type RevertPayload struct {
+	Version             int      `json:"version"`
+	Timestamp           string   `json:"timestamp"`
+	UpdatedTimestamp    int64    `json:"updatedTimestamp"`
+}
+
+// POST /records/{id}/revert
+// PostRecordRevert creates a new version of the record whose data equals the data of the target version, or of
+// the version in effect at the target timestamp. The new version is effective at updatedTimestamp, or now.
+func (a *API) PostRecordRevert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	provenance, err := readProvenance(r)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	var payload RevertPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		writeRequestProblem(w, http.StatusBadRequest, CodeMalformedRequest, "invalid input; could not parse json")
+		return
+	}
+
+	if (payload.Version == 0) == (payload.Timestamp == "") {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid input; exactly one of version or timestamp is required")
+		return
+	}
+
+	if payload.UpdatedTimestamp == 0 {
+		payload.UpdatedTimestamp = time.Now().Unix()
+	}
+
+	var target entity.Record
+	if payload.Version != 0 {
+		target, err = a.records.GetVersionedRecord(ctx, int(idNumber), payload.Version)
+	} else {
+		timestamp, errInParsing := parseTimestamp(payload.Timestamp)
+		if errInParsing != nil {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidTimestamp, "invalid timestamp; expected unix seconds or an RFC 3339 timestamp")
+			return
+		}
+		target, err = a.records.GetRecordAt(ctx, int(idNumber), timestamp)
+	}
+
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	result, err := a.records.RevertRecord(ctx, int(idNumber), target, payload.UpdatedTimestamp, provenance)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	err = writeJSON(w, result, http.StatusOK)
+	logError(err)
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"errors"
 	"net/http"
 	"strconv"
@@ -16,6 +18,8 @@ import (
 // POST /records/{id}
 // if the record exists, the record is updated.
 // if the record doesn't exist, the record is created.
+// With an If-Match header, the record is only updated if its ETag matches, and is never created.
+// With an Idempotency-Key header, a retry of the request returns the original response instead of writing again.
 func (a *API) PostRecords(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := mux.Vars(r)["id"]
@@ -27,6 +31,13 @@ func (a *API) PostRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := writeOptions(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
 	var body map[string]*string
 	err = json.NewDecoder(r.Body).Decode(&body)
 
@@ -36,7 +47,23 @@ func (a *API) PostRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := a.ProcessInput(ctx, int(idNumber), time.Now().Unix(), body)
+	result, err := a.ProcessInput(ctx, int(idNumber), time.Now().Unix(), body, opts)
+	if writeCancelled(w, err) {
+		return
+	}
+
+	if errors.Is(err, service.ErrPreconditionFailed) {
+		err := writeError(w, err.Error(), http.StatusPreconditionFailed)
+		logError(err)
+		return
+	}
+
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		err := writeError(w, err.Error(), http.StatusUnprocessableEntity)
+		logError(err)
+		return
+	}
+
 	if err != nil {
 		errInWriting := writeError(w, ErrInternal.Error(), http.StatusInternalServerError)
 		logError(err)
@@ -44,32 +71,57 @@ func (a *API) PostRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = writeJSON(w, record.GetRecordV1(), http.StatusOK)
+	w.Header().Set("ETag", etag(result.Revision))
+	err = writeJSON(w, result.GetRecordV1(), http.StatusOK)
 	logError(err)
 }
 
 type RecordPayload struct {
-	UpdatedTimestamp    int64                 `json:updatedTimestamp`
-	Data                map[string]*string    `json:data`
+	UpdatedTimestamp    int64                 `json:"updatedTimestamp"`
+	Data                map[string]*string    `json:"data"`
+	Kind                string                `json:"kind"`
 }
 
 
+// POST /records/{id}?onConflict={skip|overwrite|reject}
+// Creates or updates the record as of updatedTimestamp. A back-dated update is reflected in later versions
+// of the record. The response lists the later versions that explicitly changed one of the updated keys,
+// which are resolved according to onConflict (skip by default).
+// The kind of the write is change by default. A correction restates the version in effect at updatedTimestamp
+// instead of appending a new one, because its data was entered wrongly.
+// With an If-Match header, the record is only updated if its ETag matches, and is never created.
+// With an Idempotency-Key header, a retry of the request returns the original response instead of writing again.
 func (a *API) PostRecordsAtAGivenTime(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := mux.Vars(r)["id"]
 	idNumber, err := strconv.ParseInt(id, 10, 32)
 
 	if err != nil || idNumber <= 0 {
-		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
-		logError(err)
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	policy := service.ConflictPolicy(r.URL.Query().Get("onConflict"))
+	if policy == "" {
+		policy = service.ConflictSkip
+	}
+
+	if policy != service.ConflictSkip && policy != service.ConflictOverwrite && policy != service.ConflictReject {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid onConflict; expected one of skip, overwrite or reject")
+		return
+	}
+
+	opts, err := writeOptions(r)
+	if err != nil {
+		writeServiceProblem(w, err)
 		return
 	}
+	opts.OnConflict = policy
 
 	var recordPayload RecordPayload
 	err = json.NewDecoder(r.Body).Decode(&recordPayload)
 	if err != nil {
-		err := writeError(w, "invalid input; could not parse json", http.StatusBadRequest)
-		logError(err)
+		writeRequestProblem(w, http.StatusBadRequest, CodeMalformedRequest, "invalid input; could not parse json")
 		return
 	}
 
@@ -80,51 +132,66 @@ func (a *API) PostRecordsAtAGivenTime(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(recordPayload.Data) == 0 {
-		err := writeError(w, "invalid input; The payload to update the record is empty.", http.StatusBadRequest)
-		logError(err)
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid input; The payload to update the record is empty.")
 		return
 	}
 
-	record, err := a.ProcessInput(ctx, int(idNumber), recordPayload.UpdatedTimestamp, recordPayload.Data)
+	if recordPayload.Kind == "" {
+		recordPayload.Kind = entity.KindChange
+	}
+
+	if !entity.ValidKind(recordPayload.Kind) {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid kind; expected one of change or correction")
+		return
+	}
+	opts.Kind = recordPayload.Kind
+
+	result, err := a.ProcessInput(ctx, int(idNumber), recordPayload.UpdatedTimestamp, recordPayload.Data, opts)
 	if err != nil {
-		errInWriting := writeError(w, ErrInternal.Error(), http.StatusInternalServerError)
-		logError(err)
+		problem := serviceProblem(err)
+		if errors.Is(err, service.ErrUpdateConflict) {
+			problem.Conflicts = result.Conflicts
+		}
+
+		errInWriting := writeProblem(w, problem)
 		logError(errInWriting)
 		return
 	}
 
-	err = writeJSON(w, record, http.StatusOK)
+	w.Header().Set("ETag", etag(result.Revision))
+	err = writeJSON(w, result, http.StatusOK)
 	logError(err)
 }
 
-func (a *API) ProcessInput(ctx context.Context, recordId int, updatedTimestamp int64, body map[string]*string) (entity.Record, error) {
-
-	// Check for the existence of the record
-	record, err := a.records.GetRecord(ctx, recordId)
-
-	// record exists
-	if !errors.Is(err, service.ErrRecordDoesNotExist) {
+// writeOptions reads the If-Match, Idempotency-Key and provenance headers of a write. The body of the request is
+// read to identify the request along with its method, path, onConflict and headers, and replaced so it can be decoded
+// afterwards. Invalid headers are a validation error.
+func writeOptions(r *http.Request) (service.UpdateOptions, error) {
+	opts := service.UpdateOptions{ IfMatch: parseIfMatch(r.Header.Get("If-Match")) }
 
-		record, err = a.records.UpdateRecord(ctx, recordId, updatedTimestamp, body)
-
-	} else { // record does not exist
+	provenance, err := readProvenance(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Provenance = provenance
 
-		recordMap := map[string]string{}
-		for key, value := range body {
-			if value != nil {
-				recordMap[key] = *value
-			}
-		}
+	opts.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if len(opts.IdempotencyKey) > maxIdempotencyKeyLength {
+		return opts, &service.Error{ Kind: service.KindValidation, Code: "invalid_idempotency_key", Message: "invalid Idempotency-Key; the key must be at most 255 characters" }
+	}
 
-		record = entity.Record{
-			ID:  recordId,
-			Version: 1,
-			UpdatedTimestamp: updatedTimestamp,
-			ReportedTimestamp: 0,
-			Data: recordMap,
-		}
-		record, err = a.records.CreateRecord(ctx, record)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return opts, &service.Error{ Kind: service.KindValidation, Code: CodeMalformedRequest, Message: "invalid input; could not read the body", Err: err }
 	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	opts.RequestHash = requestHash(r, body)
+
+	return opts, nil
+}
 
-	return record, err
+// ProcessInput creates the record if it doesn't exist, and otherwise updates it. A deleted record is brought back
+// by the update.
+func (a *API) ProcessInput(ctx context.Context, recordId int, updatedTimestamp int64, body map[string]*string, opts service.UpdateOptions) (entity.UpdateResult, error) {
+	return a.records.WriteRecord(ctx, recordId, updatedTimestamp, body, opts)
 }
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+	"github.com/rainbowmga/timetravel/service"
+)
+
+const maxTransactionSize = 100
+
+// A write to one record of a transaction.
+type TransactionWritePayload struct {
+	ID                  int                   `json:"id"`
+	UpdatedTimestamp    int64                 `json:"updatedTimestamp"`
+	Data                map[string]*string    `json:"data"`
+	Kind                string                `json:"kind"`
+}
+
+// The writes of a transaction, applied in order.
+type TransactionPayload struct {
+	Writes    []TransactionWritePayload    `json:"writes"`
+}
+
+// POST /transactions?onConflict={skip|overwrite|reject}
+// Creates or updates several records in one transaction: either every write is applied or none is. Each write
+// behaves like POST /records/{id} and the response lists the result of each write in order.
+func (a *API) PostTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	policy := service.ConflictPolicy(r.URL.Query().Get("onConflict"))
+	if policy == "" {
+		policy = service.ConflictSkip
+	}
+
+	if policy != service.ConflictSkip && policy != service.ConflictOverwrite && policy != service.ConflictReject {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, "invalid onConflict; expected one of skip, overwrite or reject")
+		return
+	}
+
+	provenance, err := readProvenance(r)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	var payload TransactionPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		writeRequestProblem(w, http.StatusBadRequest, CodeMalformedRequest, "invalid input; could not parse json")
+		return
+	}
+
+	if len(payload.Writes) == 0 || len(payload.Writes) > maxTransactionSize {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, fmt.Sprintf("invalid input; writes must contain between 1 and %v writes", maxTransactionSize))
+		return
+	}
+
+	writes := []service.RecordWrite{}
+	for i, write := range payload.Writes {
+		if write.ID <= 0 {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, fmt.Sprintf("invalid id in write %v; id must be a positive number", i))
+			return
+		}
+
+		if len(write.Data) == 0 {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, fmt.Sprintf("invalid input; the data of write %v is empty", i))
+			return
+		}
+
+		// The updatedTimestamp of a write is optional and defaults to now.
+		if write.UpdatedTimestamp == 0 {
+			write.UpdatedTimestamp = time.Now().Unix()
+		}
+
+		if write.Kind == "" {
+			write.Kind = entity.KindChange
+		}
+
+		if !entity.ValidKind(write.Kind) {
+			writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidInput, fmt.Sprintf("invalid kind in write %v; expected one of change or correction", i))
+			return
+		}
+
+		writes = append(writes, service.RecordWrite{ ID: write.ID, UpdatedTimestamp: write.UpdatedTimestamp, Updates: write.Data, Kind: write.Kind })
+	}
+
+	results, err := a.records.ApplyTransaction(ctx, writes, service.UpdateOptions{ OnConflict: policy, Provenance: provenance })
+	if err != nil {
+		problem := serviceProblem(err)
+		if errors.Is(err, service.ErrUpdateConflict) {
+			problem.Conflicts = results[len(results)-1].Conflicts
+		}
+
+		errInWriting := writeProblem(w, problem)
+		logError(errInWriting)
+		return
+	}
+
+	err = writeJSON(w, results, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// POST /records/{id}/version/{versionId}/retract
+// PostVersionRetract retracts a mistaken version of the record as of now. The version no longer contributes to
+// current or time-travel reads, while reads with a knownAt before the retraction still see it. Later changes that
+// the version overwrote are restored. The response is the retracted version as it was, and the reason for the
+// retraction is taken from the X-Change-Reason header.
+func (a *API) PostVersionRetract(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidID, "invalid id; id must be a positive number")
+		return
+	}
+
+	versionId := mux.Vars(r)["versionId"]
+	version, err := strconv.ParseInt(versionId, 10, 32)
+
+	if err != nil || version <= 0 {
+		writeRequestProblem(w, http.StatusUnprocessableEntity, CodeInvalidVersion, "invalid version; version must be a positive number")
+		return
+	}
+
+	provenance, err := readProvenance(r)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	record, err := a.records.RetractVersion(ctx, int(idNumber), int(version), provenance)
+	if err != nil {
+		writeServiceProblem(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(record.Revision))
+	err = writeJSON(w, record, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/rainbowmga/timetravel/entity"
+	"github.com/rainbowmga/timetravel/service"
+)
+
+// The machine-readable codes of the problems found in a request before it reaches the service. The problems
+// reported by the service carry the code of the service error.
+const (
+	CodeMalformedRequest = "malformed_request"
+	CodeInvalidID        = "invalid_id"
+	CodeInvalidVersion   = "invalid_version"
+	CodeInvalidTimestamp = "invalid_timestamp"
+	CodeInvalidInput     = "invalid_input"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+)
+
+// A problem details response as defined by RFC 9457, extended with the machine-readable code of the problem and,
+// for an update conflict, the conflicting versions.
+type Problem struct {
+	Type        string              `json:"type"`
+	Title       string              `json:"title"`
+	Status      int                 `json:"status"`
+	Code        string              `json:"code"`
+	Detail      string              `json:"detail,omitempty"`
+	Conflicts   []entity.Conflict   `json:"conflicts,omitempty"`
+}
+
+// writeProblem writes the problem as application/problem+json.
+func writeProblem(w http.ResponseWriter, problem Problem) error {
+	log.Printf("response errored: %s: %s", problem.Code, problem.Detail)
+
+	problem.Type = "about:blank"
+	problem.Title = http.StatusText(problem.Status)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	return json.NewEncoder(w).Encode(problem)
+}
+
+// writeRequestProblem answers a request that is invalid before it reaches the service: 400 when the request
+// cannot be parsed, and 422 when its values are invalid.
+func writeRequestProblem(w http.ResponseWriter, status int, code string, detail string) {
+	err := writeProblem(w, Problem{ Status: status, Code: code, Detail: detail })
+	logError(err)
+}
+
+// serviceProblem maps an error returned by the service to a problem. Not found is 404, conflict 409, validation
+// 422, a failed precondition 412 and anything else 500, whose details are logged rather than returned.
+func serviceProblem(err error) Problem {
+	serviceErr := service.AsError(err)
+	problem := Problem{ Code: serviceErr.Code, Detail: err.Error() }
+
+	switch serviceErr.Kind {
+	case service.KindNotFound:
+		problem.Status = http.StatusNotFound
+	case service.KindConflict:
+		problem.Status = http.StatusConflict
+	case service.KindValidation:
+		problem.Status = http.StatusUnprocessableEntity
+	case service.KindPrecondition:
+		problem.Status = http.StatusPreconditionFailed
+	case service.KindCancelled:
+		problem.Status = statusClientClosedRequest
+		if errors.Is(err, context.DeadlineExceeded) {
+			problem.Status = http.StatusGatewayTimeout
+		}
+	default:
+		logError(err)
+		problem.Status = http.StatusInternalServerError
+		problem.Code = CodeInternal
+		problem.Detail = ErrInternal.Error()
+	}
+
+	return problem
+}
+
+// writeServiceProblem answers a request that failed in the service.
+func writeServiceProblem(w http.ResponseWriter, err error) {
+	errInWriting := writeProblem(w, serviceProblem(err))
+	logError(errInWriting)
+}
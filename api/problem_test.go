@@ -0,0 +1,23 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/service"
+)
+
+// A cancelled request is answered with 499 and one whose deadline passed with 504, as the service returns them.
+func TestCancelledServiceProblem(t *testing.T) {
+	for cause, status := range map[error]int{
+		context.Canceled:         statusClientClosedRequest,
+		context.DeadlineExceeded: http.StatusGatewayTimeout,
+	} {
+		problem := serviceProblem(fmt.Errorf("%w: %w", service.ErrCancelled, cause))
+		if problem.Status != status || problem.Code != service.ErrCancelled.Code {
+			t.Errorf("expected %v to be answered with %d %s, got %d %s", cause, status, service.ErrCancelled.Code, problem.Status, problem.Code)
+		}
+	}
+}
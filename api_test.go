@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Serve the API over a migrated database in a temporary directory.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "insurance_data.db")
+	db, err := connectToDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := performDBMigration(db); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	readDB, err := connectToReadDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database for reads: %v", err)
+	}
+	t.Cleanup(func() { readDB.Close() })
+
+	server := httptest.NewServer(newRouter(db, readDB, nil))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Send a request with the headers to the server and return the response, with its body read.
+func send(t *testing.T, server *httptest.Server, method string, path string, body string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not build the request: %v", err)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("could not read the response: %v", err)
+	}
+	return response, data
+}
+
+// Check the status of a response.
+func expectStatus(t *testing.T, what string, response *http.Response, body []byte, status int) {
+	t.Helper()
+
+	if response.StatusCode != status {
+		t.Fatalf("%s: expected %d, got %d: %s", what, status, response.StatusCode, body)
+	}
+}
+
+// The times of a batch read are unix seconds like every other v2 body, or RFC 3339 strings.
+func TestBatchGetTimestamps(t *testing.T) {
+	server := newTestServer(t)
+
+	response, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "1"}}`, nil)
+	expectStatus(t, "the write", response, body, http.StatusOK)
+
+	for _, payload := range []string{
+		`{"ids": [1], "at": 100, "knownAt": 4102444800}`,
+		`{"ids": [1], "at": "100"}`,
+		`{"ids": [1], "at": "1970-01-01T00:01:40Z"}`,
+	} {
+		response, body := send(t, server, "POST", "/api/v2/records:batchGet", payload, nil)
+		expectStatus(t, payload, response, body, http.StatusOK)
+
+		var batch struct {
+			Records []struct {
+				ID   int               `json:"id"`
+				Data map[string]string `json:"data"`
+			} `json:"records"`
+		}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Fatalf("could not decode the batch: %v", err)
+		}
+		if len(batch.Records) != 1 || batch.Records[0].Data["a"] != "1" {
+			t.Errorf("%s: expected record 1 as of 100, got %s", payload, body)
+		}
+	}
+
+	response, body = send(t, server, "POST", "/api/v2/records:batchGet", `{"ids": [1], "at": 100.5}`, nil)
+	expectStatus(t, "a fractional timestamp", response, body, http.StatusUnprocessableEntity)
+}
+
+func TestBatchGetDuplicateIds(t *testing.T) {
+	server := newTestServer(t)
+
+	response, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "1"}}`, nil)
+	expectStatus(t, "the write", response, body, http.StatusOK)
+
+	response, body = send(t, server, "POST", "/api/v2/records:batchGet", `{"ids": [1, 2, 1]}`, nil)
+	expectStatus(t, "the batch read", response, body, http.StatusOK)
+
+	var batch struct {
+		Records []json.RawMessage `json:"records"`
+		Missing []int             `json:"missing"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		t.Fatalf("could not decode the batch: %v", err)
+	}
+	if len(batch.Records) != 1 || len(batch.Missing) != 1 || batch.Missing[0] != 2 {
+		t.Errorf("expected record 1 once and 2 missing, got %s", body)
+	}
+}
+
+// A v2 write back-dated before the first version of an existing record is a validation problem, not a missing record.
+func TestWriteBeforeFirstVersion(t *testing.T) {
+	server := newTestServer(t)
+
+	response, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 1000, "data": {"a": "1"}}`, nil)
+	expectStatus(t, "the write", response, body, http.StatusOK)
+
+	response, body = send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 500, "data": {"a": "0"}}`, nil)
+	expectStatus(t, "the back-dated write", response, body, http.StatusUnprocessableEntity)
+
+	if !strings.Contains(string(body), `"code":"before_first_version"`) || !strings.Contains(string(body), "took effect at 1000") {
+		t.Errorf("expected a before_first_version problem naming the first version, got %s", body)
+	}
+}
+
+// Count the versions of a record through the API.
+func countVersions(t *testing.T, server *httptest.Server, id string) int {
+	t.Helper()
+
+	response, body := send(t, server, "GET", "/api/v2/records/"+id+"/versions", "", nil)
+	expectStatus(t, "the versions", response, body, http.StatusOK)
+
+	var versions []json.RawMessage
+	if err := json.Unmarshal(body, &versions); err != nil {
+		t.Fatalf("could not decode the versions: %v", err)
+	}
+	return len(versions)
+}
+
+// A retry with the same idempotency key is answered with the first response without writing again.
+func TestIdempotentReplay(t *testing.T) {
+	server := newTestServer(t)
+
+	headers := map[string]string{ "Idempotency-Key": "key-1", "X-Source-Channel": "portal", "X-Change-Reason": "renewal" }
+	payload := `{"updatedTimestamp": 100, "data": {"a": "1"}}`
+
+	first, firstBody := send(t, server, "POST", "/api/v2/records/1", payload, headers)
+	expectStatus(t, "the write", first, firstBody, http.StatusOK)
+
+	retry, retryBody := send(t, server, "POST", "/api/v2/records/1", payload, headers)
+	expectStatus(t, "the retry", retry, retryBody, http.StatusOK)
+
+	if string(retryBody) != string(firstBody) {
+		t.Errorf("expected the retry to be answered with %s, got %s", firstBody, retryBody)
+	}
+	if versions := countVersions(t, server, "1"); versions != 1 {
+		t.Errorf("expected the retry not to write, got %d versions", versions)
+	}
+}
+
+// A key reused for a request that would write something else is rejected, whatever part of the request differs.
+func TestIdempotencyKeyReused(t *testing.T) {
+	server := newTestServer(t)
+
+	headers := func(overrides map[string]string) map[string]string {
+		headers := map[string]string{ "Idempotency-Key": "key-1", "X-Authenticated-User": "alice", "X-Source-Channel": "portal", "X-Change-Reason": "renewal" }
+		for name, value := range overrides {
+			headers[name] = value
+		}
+		return headers
+	}
+	payload := `{"updatedTimestamp": 100, "data": {"a": "1"}}`
+
+	response, body := send(t, server, "POST", "/api/v2/records/1", payload, headers(nil))
+	expectStatus(t, "the write", response, body, http.StatusOK)
+
+	reuses := []struct {
+		what     string
+		path     string
+		payload  string
+		headers  map[string]string
+	}{
+		{ "a different body", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "2"}}`, headers(nil) },
+		{ "a different onConflict", "/api/v2/records/1?onConflict=overwrite", payload, headers(nil) },
+		{ "a different If-Match", "/api/v2/records/1", payload, headers(map[string]string{ "If-Match": `"1"` }) },
+		{ "a different actor", "/api/v2/records/1", payload, headers(map[string]string{ "X-Authenticated-User": "bob" }) },
+		{ "a different source", "/api/v2/records/1", payload, headers(map[string]string{ "X-Source-Channel": "underwriter" }) },
+		{ "a different reason", "/api/v2/records/1", payload, headers(map[string]string{ "X-Change-Reason": "correction" }) },
+	}
+
+	for _, reuse := range reuses {
+		response, body := send(t, server, "POST", reuse.path, reuse.payload, reuse.headers)
+		expectStatus(t, reuse.what, response, body, http.StatusUnprocessableEntity)
+
+		if !strings.Contains(string(body), `"code":"idempotency_key_reused"`) {
+			t.Errorf("%s: expected idempotency_key_reused, got %s", reuse.what, body)
+		}
+	}
+
+	if versions := countVersions(t, server, "1"); versions != 1 {
+		t.Errorf("expected the rejected requests not to write, got %d versions", versions)
+	}
+}
+
+// Writes and reads return the ETag of the revision of the record, and a write with If-Match is only applied to that
+// revision.
+func TestIfMatch(t *testing.T) {
+	server := newTestServer(t)
+
+	created, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "1"}}`, nil)
+	expectStatus(t, "the write", created, body, http.StatusOK)
+
+	tag := created.Header.Get("ETag")
+	if tag == "" || !strings.HasPrefix(tag, `"`) {
+		t.Fatalf("expected a strong ETag on the write, got %q", tag)
+	}
+
+	for _, path := range []string{ "/api/v1/records/1", "/api/v2/records/1" } {
+		read, body := send(t, server, "GET", path, "", nil)
+		expectStatus(t, path, read, body, http.StatusOK)
+
+		if read.Header.Get("ETag") != tag {
+			t.Errorf("%s: expected the ETag %s, got %q", path, tag, read.Header.Get("ETag"))
+		}
+	}
+
+	updated, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 200, "data": {"a": "2"}}`, map[string]string{ "If-Match": tag })
+	expectStatus(t, "the write with the current ETag", updated, body, http.StatusOK)
+
+	if updated.Header.Get("ETag") == tag {
+		t.Errorf("expected the write to move the ETag on from %s", tag)
+	}
+
+	stale, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 300, "data": {"a": "3"}}`, map[string]string{ "If-Match": tag })
+	expectStatus(t, "the write with a stale ETag", stale, body, http.StatusPreconditionFailed)
+
+	if !strings.Contains(string(body), `"code":"precondition_failed"`) {
+		t.Errorf("expected precondition_failed, got %s", body)
+	}
+
+	// A tag that lists the current revision among others matches.
+	listed, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 300, "data": {"a": "3"}}`, map[string]string{ "If-Match": tag + ", " + updated.Header.Get("ETag") })
+	expectStatus(t, "the write with a list of ETags", listed, body, http.StatusOK)
+
+	if versions := countVersions(t, server, "1"); versions != 3 {
+		t.Errorf("expected the stale write not to be applied, got %d versions", versions)
+	}
+}
+
+// If-Match: * matches any existing record, and never creates one.
+func TestIfMatchAny(t *testing.T) {
+	server := newTestServer(t)
+
+	response, body := send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "1"}}`, map[string]string{ "If-Match": "*" })
+	expectStatus(t, "the write to a missing record", response, body, http.StatusPreconditionFailed)
+
+	response, body = send(t, server, "GET", "/api/v2/records/1", "", nil)
+	expectStatus(t, "the missing record", response, body, http.StatusNotFound)
+
+	response, body = send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 100, "data": {"a": "1"}}`, nil)
+	expectStatus(t, "the write", response, body, http.StatusOK)
+
+	response, body = send(t, server, "POST", "/api/v2/records/1", `{"updatedTimestamp": 200, "data": {"a": "2"}}`, map[string]string{ "If-Match": "*" })
+	expectStatus(t, "the write to an existing record", response, body, http.StatusOK)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Build the document of an export of a record with two chained rows, and the verification of its chain.
+func newDocument(t *testing.T) entity.AuditDocument {
+	t.Helper()
+
+	var rows []entity.AuditRow
+	prevHash := ""
+	for i, changes := range []string{ `{"a":"1"}`, `{"a":"2"}` } {
+		row := entity.AuditRow{ Row: int64(i + 1), ChainedVersion: entity.ChainedVersion{
+			RecordId: 1, VersionId: i + 1, UpdatedTimestamp: int64(100 * (i + 1)), CreatedAt: int64(100 * (i + 1)),
+			Changes: changes, Kind: entity.KindChange, PrevHash: prevHash,
+		} }
+
+		hash, err := row.ChainedVersion.Hash()
+		if err != nil {
+			t.Fatalf("could not hash the row: %v", err)
+		}
+		row.Hash = hash
+		prevHash = hash
+
+		rows = append(rows, row)
+	}
+
+	chain, err := entity.VerifyChain(1, rows)
+	if err != nil || !chain.Valid {
+		t.Fatalf("expected the chain to verify, got %+v, %v", chain, err)
+	}
+	return entity.NewAuditDocument(1, 300, []entity.Record{}, rows, chain)
+}
+
+// Write the export to a file and return its path.
+func writeExport(t *testing.T, export entity.SignedAuditExport) string {
+	t.Helper()
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("could not encode the export: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("could not write the export: %v", err)
+	}
+	return path
+}
+
+// Sign the document with a new key and return the export along with the base64 public key.
+func signDocument(t *testing.T, document entity.AuditDocument) (entity.SignedAuditExport, string) {
+	t.Helper()
+
+	publicKey, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("could not generate the key: %v", err)
+	}
+
+	export, err := entity.SignAuditDocument(document, key)
+	if err != nil {
+		t.Fatalf("could not sign the document: %v", err)
+	}
+	return export, base64.StdEncoding.EncodeToString(publicKey)
+}
+
+func TestVerifyValidExport(t *testing.T) {
+	export, publicKey := signDocument(t, newDocument(t))
+
+	if err := run(publicKey, writeExport(t, export)); err != nil {
+		t.Errorf("expected the export to verify, got %v", err)
+	}
+}
+
+func TestVerifyTamperedDocument(t *testing.T) {
+	export, publicKey := signDocument(t, newDocument(t))
+
+	tampered := bytes.Replace(export.Document, []byte(`\"a\":\"2\"`), []byte(`\"a\":\"3\"`), 1)
+	if bytes.Equal(tampered, export.Document) {
+		t.Fatalf("could not tamper with the document: %s", export.Document)
+	}
+	export.Document = tampered
+
+	err := run(publicKey, writeExport(t, export))
+	if !errors.Is(err, entity.ErrAuditSignatureInvalid) {
+		t.Errorf("expected ErrAuditSignatureInvalid, got %v", err)
+	}
+}
+
+// An export re-signed by someone else carries their key, which must not be trusted over the key given.
+func TestVerifyWrongPublicKey(t *testing.T) {
+	export, _ := signDocument(t, newDocument(t))
+	_, otherPublicKey := signDocument(t, newDocument(t))
+
+	err := run(otherPublicKey, writeExport(t, export))
+	if !errors.Is(err, entity.ErrAuditSignatureInvalid) {
+		t.Errorf("expected ErrAuditSignatureInvalid, got %v", err)
+	}
+}
+
+func TestVerifyWithoutPublicKey(t *testing.T) {
+	export, _ := signDocument(t, newDocument(t))
+
+	err := run("", writeExport(t, export))
+	if err == nil || !strings.Contains(err.Error(), "-public-key is required") {
+		t.Errorf("expected the missing -public-key to fail, got %v", err)
+	}
+}
+
+// A document whose recorded head is not the head of its rows, such as one exported before rows were removed from the
+// end of the history, fails even though its signature checks out.
+func TestVerifyHeadDiffersFromChain(t *testing.T) {
+	document := newDocument(t)
+	document.Rows = document.Rows[:1]
+
+	export, publicKey := signDocument(t, document)
+
+	err := run(publicKey, writeExport(t, export))
+	if err == nil || !strings.Contains(err.Error(), "hash chain of the export is broken") {
+		t.Errorf("expected the head mismatch to fail, got %v", err)
+	}
+
+	_, verification, err := export.Verify(mustDecodeKey(t, publicKey))
+	if err != nil {
+		t.Fatalf("could not verify the export: %v", err)
+	}
+	if verification.Valid || len(verification.Failures) != 1 || !strings.Contains(verification.Failures[0].Reason, "head recorded in the document") {
+		t.Errorf("expected only the head to fail, got %+v", verification)
+	}
+}
+
+func mustDecodeKey(t *testing.T, encoded string) ed25519.PublicKey {
+	t.Helper()
+
+	publicKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("could not decode the key: %v", err)
+	}
+	return ed25519.PublicKey(publicKey)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// The v1 API is a contract with existing clients: its responses must stay byte-for-byte the same while the v2
+// API evolves. The exchanges below are replayed against a fresh database and compared with testdata.
+func TestV1Contract(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "insurance_data.db")
+	db, err := connectToDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	defer db.Close()
+
+	if err := performDBMigration(db); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	readDB, err := connectToReadDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database for reads: %v", err)
+	}
+	defer readDB.Close()
+
+	server := httptest.NewServer(newRouter(db, readDB, nil))
+	defer server.Close()
+
+	exchanges := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/api/v1/health", ""},
+		{"POST", "/api/v1/records/1", `{"hello": "world"}`},
+		{"GET", "/api/v1/records/1", ""},
+		{"POST", "/api/v1/records/1", `{"hello": "world 2", "status": "ok"}`},
+		{"POST", "/api/v1/records/1", `{"hello": null}`},
+		{"GET", "/api/v1/records/1", ""},
+		{"GET", "/api/v1/records/32", ""},
+		{"GET", "/api/v1/records/abc", ""},
+		{"GET", "/api/v1/records/-1", ""},
+		{"POST", "/api/v1/records/0", `{"hello": "world"}`},
+		{"POST", "/api/v1/records/2", `not json`},
+	}
+
+	var transcript strings.Builder
+	for _, exchange := range exchanges {
+		request, err := http.NewRequest(exchange.method, server.URL+exchange.path, strings.NewReader(exchange.body))
+		if err != nil {
+			t.Fatalf("could not build the request: %v", err)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", exchange.method, exchange.path, err)
+		}
+
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatalf("could not read the response: %v", err)
+		}
+
+		fmt.Fprintf(&transcript, "> %s %s %s\n", exchange.method, exchange.path, exchange.body)
+		fmt.Fprintf(&transcript, "< %d %s\n%s\n", response.StatusCode, response.Header.Get("Content-Type"), body)
+	}
+
+	golden := filepath.Join("testdata", "v1_contract.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(transcript.String()), 0644); err != nil {
+			t.Fatalf("could not write the golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("could not read the golden file: %v", err)
+	}
+
+	if transcript.String() != string(want) {
+		t.Errorf("the v1 responses changed.\ngot:\n%s\nwant:\n%s", transcript.String(), want)
+	}
+}
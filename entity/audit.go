@@ -0,0 +1,261 @@
+package entity
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The algorithm that signs audit exports.
+const AuditSignatureAlgorithm = "ed25519"
+
+var ErrAuditSignatureInvalid = errors.New("the signature of the audit export does not match its document")
+
+// A row of the history of a record as it is hashed into the chain: every column of record_versions except the row id
+// and superseded_at, which is set when the row is closed out. Closing out a row is covered by the row that
+// supersedes it instead. RestatedBy is the row of the write that restated the version, and is left out of the hash
+// when it is not set. PrevHash is the hash of the previous row of the record, empty for the first row.
+type ChainedVersion struct {
+	RecordId               int                 `json:"recordId"`
+	VersionId              int                 `json:"versionId"`
+	UpdatedTimestamp       int64               `json:"updatedTimestamp"`
+	CreatedAt              int64               `json:"createdAt"`
+	Supersedes             *int64              `json:"supersedes"`
+	RestatedBy             *int64              `json:"restatedBy,omitempty"`
+	Changes                string              `json:"changes"`
+	Tombstone              bool                `json:"tombstone"`
+	Actor                  string              `json:"actor"`
+	Source                 string              `json:"source"`
+	Reason                 string              `json:"reason"`
+	Kind                   string              `json:"kind"`
+	Retracted              bool                `json:"retracted"`
+	PrevHash               string              `json:"prevHash"`
+}
+
+// Method to compute the hash of the row: the hex sha256 of its json encoding.
+func (v ChainedVersion) Hash() (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// A row of the history of a record as stored: its id, its hashed contents, when it was closed out and its hash.
+// SupersededAt is nil while the row is current.
+type AuditRow struct {
+	Row                    int64               `json:"row"`
+	ChainedVersion
+	SupersededAt           *int64              `json:"supersededAt"`
+	Hash                   string              `json:"hash"`
+}
+
+// The timestamps of the row are followed by their RFC 3339 renderings, like those of a record.
+func (d AuditRow) MarshalJSON() ([]byte, error) {
+	type plainAuditRow AuditRow
+
+	var supersededTime *string
+	if d.SupersededAt != nil {
+		formatted := formatTime(*d.SupersededAt)
+		supersededTime = &formatted
+	}
+
+	return json.Marshal(struct {
+		plainAuditRow
+		UpdatedTime            string              `json:"updatedTime"`
+		CreatedTime            string              `json:"createdTime"`
+		SupersededTime         *string             `json:"supersededTime"`
+	}{ plainAuditRow(d), formatTime(d.UpdatedTimestamp), formatTime(d.CreatedAt), supersededTime })
+}
+
+// Check the hash chain over the rows of the history of a record, in the order they were written. Every row must
+// hash to its stored hash, point at the hash of the previous row, and agree with the rows that supersede it: a row
+// is closed out exactly when a later row supersedes it, at the time that row was written. A retraction row, which is
+// closed out as it is written, is the only exception.
+func VerifyChain(id int, rows []AuditRow) (ChainVerification, error) {
+	verification := ChainVerification{ ID: id, Rows: len(rows), Failures: []ChainFailure{} }
+	fail := func(row AuditRow, reason string) {
+		verification.Failures = append(verification.Failures, ChainFailure{ Row: row.Row, Version: row.VersionId, Reason: reason })
+	}
+
+	positions := map[int64]int{}
+	superseded := map[int64]bool{}
+	prevHash := ""
+
+	for i, row := range rows {
+		positions[row.Row] = i
+
+		hash, err := row.ChainedVersion.Hash()
+		if err != nil {
+			return ChainVerification{}, err
+		}
+
+		if row.RecordId != id {
+			fail(row, fmt.Sprintf("the row belongs to record %d", row.RecordId))
+		}
+
+		if row.Hash == "" {
+			fail(row, "the row has no hash")
+		} else if row.Hash != hash {
+			fail(row, "the hash does not match the contents of the row")
+		}
+
+		if row.PrevHash != prevHash {
+			fail(row, "the previous hash does not match the hash of the previous row")
+		}
+		prevHash = row.Hash
+
+		if row.Supersedes != nil {
+			position, ok := positions[*row.Supersedes]
+			if !ok {
+				fail(row, fmt.Sprintf("the row supersedes row %d, which is not an earlier row of the record", *row.Supersedes))
+				continue
+			}
+
+			supersededRow := rows[position]
+			superseded[supersededRow.Row] = true
+			if supersededRow.SupersededAt == nil || *supersededRow.SupersededAt != row.CreatedAt {
+				fail(supersededRow, fmt.Sprintf("the row is not closed out when row %d supersedes it", row.Row))
+			}
+		}
+
+		if row.RestatedBy != nil {
+			if _, ok := positions[*row.RestatedBy]; !ok || *row.RestatedBy == row.Row {
+				fail(row, fmt.Sprintf("the row is restated by row %d, which is not an earlier row of the record", *row.RestatedBy))
+			}
+		}
+	}
+
+	for _, row := range rows {
+		closedOnWrite := row.Retracted && row.SupersededAt != nil && *row.SupersededAt == row.CreatedAt
+		if row.SupersededAt != nil && !superseded[row.Row] && !closedOnWrite {
+			fail(row, "the row is closed out but no row supersedes it")
+		}
+	}
+
+	verification.Head = prevHash
+	verification.Valid = len(verification.Failures) == 0
+	return verification, nil
+}
+
+// The head of the hash chain of a record: the number of rows of its history and the hash of the latest row. The
+// service signs the head after every write and keeps the signature apart from the rows, so rows that are rewritten
+// with recomputed hashes, or removed from the end of the history, no longer match a signed head, and a new one
+// cannot be signed without the key.
+type ChainHead struct {
+	RecordId               int                 `json:"recordId"`
+	Rows                   int                 `json:"rows"`
+	Head                   string              `json:"head"`
+}
+
+// Method to sign the head with key. The signature is base64 encoded.
+func (h ChainHead) Sign(key ed25519.PrivateKey) (string, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)), nil
+}
+
+// Method to check a base64 signature of the head with publicKey.
+func (h ChainHead) VerifySignature(publicKey ed25519.PublicKey, signature string) bool {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return len(publicKey) == ed25519.PublicKeySize && ed25519.Verify(publicKey, data, decoded)
+}
+
+// The full history of a record as exported for an audit. Versions is the history as currently known, with the data
+// of every version rebuilt; Rows is every row ever written for the record, including superseded and retracted ones,
+// with the hash chain over them; Chain is the verification of that chain at the time of the export.
+type AuditDocument struct {
+	ID                     int                 `json:"id"`
+	ExportedAt             int64               `json:"exportedAt"`
+	ExportedTime           string              `json:"exportedTime"`
+	Versions               []Record            `json:"versions"`
+	Rows                   []AuditRow          `json:"rows"`
+	Chain                  ChainVerification   `json:"chain"`
+}
+
+// Method to build the document of an audit export of the record, exported at exportedAt.
+func NewAuditDocument(id int, exportedAt int64, versions []Record, rows []AuditRow, chain ChainVerification) AuditDocument {
+	return AuditDocument{
+		ID: id,
+		ExportedAt: exportedAt,
+		ExportedTime: formatTime(exportedAt),
+		Versions: versions,
+		Rows: rows,
+		Chain: chain,
+	}
+}
+
+// A signed audit export. The signature covers the exact bytes of Document. PublicKey is the key the export claims to
+// be signed with; a verifier should check it against a key it trusts. The key and the signature are base64 encoded.
+type SignedAuditExport struct {
+	Document               json.RawMessage     `json:"document"`
+	Algorithm              string              `json:"algorithm"`
+	PublicKey              string              `json:"publicKey"`
+	Signature              string              `json:"signature"`
+}
+
+// Sign the audit document with key.
+func SignAuditDocument(document AuditDocument, key ed25519.PrivateKey) (SignedAuditExport, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return SignedAuditExport{}, err
+	}
+
+	return SignedAuditExport{
+		Document: data,
+		Algorithm: AuditSignatureAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}, nil
+}
+
+// Method to verify the signature of the export with publicKey, and then the hash chain of the document it signs.
+// The document is returned along with the verification of its chain, which is valid only if the chain checks out
+// and its head is the head recorded in the document.
+func (e SignedAuditExport) Verify(publicKey ed25519.PublicKey) (AuditDocument, ChainVerification, error) {
+	if e.Algorithm != AuditSignatureAlgorithm {
+		return AuditDocument{}, ChainVerification{}, fmt.Errorf("unsupported signature algorithm %q", e.Algorithm)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return AuditDocument{}, ChainVerification{}, fmt.Errorf("decode the signature: %w", err)
+	}
+
+	if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, e.Document, signature) {
+		return AuditDocument{}, ChainVerification{}, ErrAuditSignatureInvalid
+	}
+
+	var document AuditDocument
+	if err := json.Unmarshal(e.Document, &document); err != nil {
+		return AuditDocument{}, ChainVerification{}, fmt.Errorf("decode the document: %w", err)
+	}
+
+	verification, err := VerifyChain(document.ID, document.Rows)
+	if err != nil {
+		return document, ChainVerification{}, err
+	}
+
+	if verification.Head != document.Chain.Head {
+		verification.Valid = false
+		verification.Failures = append(verification.Failures, ChainFailure{ Reason: "the head of the chain does not match the head recorded in the document" })
+	}
+
+	return document, verification, nil
+}
@@ -1,12 +1,96 @@
 package entity
 
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
 // The V2 version of the record that records the version of the attributes.
+// Version is the stable identifier of the version; it never changes once the version is written.
+// EffectivePosition is the 1-based position of the version when the versions are ordered by effective time,
+// which shifts when a back-dated version is inserted before it.
+// Deleted is set on a tombstone version, from which on the record is deleted.
+// Revision counts the version rows written for the record. It changes with every write to the record, whatever
+// its effective time, and is served as the ETag of the record.
+// Kind tells a change in the world at the effective time from a correction of data that was entered wrongly.
+// Retracted is set on a version that was retracted, which is only returned by the retraction itself.
+// Provenance records who wrote the version and why.
 type Record struct {
-	ID                     int                 `json:id`
-	Version                int                 `json:version`
-	UpdatedTimestamp       int64               `json:updatedTimestamp`
-	ReportedTimestamp      int64               `json:reportedTimestamp`
-	Data                   map[string]string   `json:data`
+	ID                     int                 `json:"id"`
+	Version                int                 `json:"version"`
+	EffectivePosition      int                 `json:"effectivePosition"`
+	Revision               int                 `json:"revision"`
+	UpdatedTimestamp       int64               `json:"updatedTimestamp"`
+	ReportedTimestamp      int64               `json:"reportedTimestamp"`
+	Data                   map[string]string   `json:"data"`
+	Deleted                bool                `json:"deleted"`
+	Kind                   string              `json:"kind"`
+	Retracted              bool                `json:"retracted"`
+	Provenance
+}
+
+// The kinds of version. A change means the world changed at the effective time of the version. A correction
+// restates a version whose data was entered wrongly, from its original effective time.
+const (
+	KindChange             = "change"
+	KindCorrection         = "correction"
+)
+
+// Report whether kind is one of the kinds of version.
+func ValidKind(kind string) bool {
+	return kind == KindChange || kind == KindCorrection
+}
+
+// The channels through which a write reaches the records.
+const (
+	SourcePortal           = "portal"
+	SourceEmailIntake      = "email_intake"
+	SourceUnderwriter      = "underwriter"
+)
+
+// Who wrote a version of a record, through which channel, and why. Actor is the authenticated user that made the
+// write. The fields are empty on versions written before they were recorded.
+type Provenance struct {
+	Actor                  string              `json:"actor"`
+	Source                 string              `json:"source"`
+	Reason                 string              `json:"reason"`
+}
+
+// Report whether source is one of the known channels. An empty source is allowed.
+func ValidSource(source string) bool {
+	switch source {
+	case "", SourcePortal, SourceEmailIntake, SourceUnderwriter:
+		return true
+	}
+	return false
+}
+
+// The record as sent on the wire: its fields, followed by its timestamps in RFC 3339.
+type recordWire struct {
+	plainRecord
+	UpdatedTime            string              `json:"updatedTime"`
+	ReportedTime           string              `json:"reportedTime"`
+}
+
+// The fields of Record without its MarshalJSON method.
+type plainRecord Record
+
+func (d Record) wire() recordWire {
+	return recordWire{
+		plainRecord: plainRecord(d),
+		UpdatedTime: formatTime(d.UpdatedTimestamp),
+		ReportedTime: formatTime(d.ReportedTimestamp),
+	}
+}
+
+func (d Record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.wire())
+}
+
+// Format an epoch timestamp in RFC 3339, in UTC.
+func formatTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
 }
 
 // The V1 version of the record.
@@ -26,9 +110,15 @@ func (d *Record) Copy() Record {
 	return Record {
 		ID: d.ID,
 		Version: d.Version,
+		EffectivePosition: d.EffectivePosition,
+		Revision: d.Revision,
 		UpdatedTimestamp: d.UpdatedTimestamp,
 		ReportedTimestamp: d.ReportedTimestamp,
 		Data: newMap,
+		Deleted: d.Deleted,
+		Kind: d.Kind,
+		Retracted: d.Retracted,
+		Provenance: d.Provenance,
 	}			
 }
 
@@ -38,3 +128,202 @@ func (d *Record) GetRecordV1() RecordV1 {
 	record := RecordV1 {ID: d.ID, Data: d.Data}
 	return record
 }
+
+// A conflict between a retroactive update and a later version that explicitly changed the same key.
+type Conflict struct {
+	Version                int                 `json:"version"`
+	UpdatedTimestamp       int64               `json:"updatedTimestamp"`
+	Key                    string              `json:"key"`
+	RetroactiveValue       *string             `json:"retroactiveValue"`
+	LaterValue             *string             `json:"laterValue"`
+}
+
+func (d Conflict) MarshalJSON() ([]byte, error) {
+	type plainConflict Conflict
+	return json.Marshal(struct {
+		plainConflict
+		UpdatedTime            string              `json:"updatedTime"`
+	}{ plainConflict(d), formatTime(d.UpdatedTimestamp) })
+}
+
+// The outcome of an update: the new version of the record and the later versions it conflicted with.
+type UpdateResult struct {
+	Record
+	Conflicts              []Conflict          `json:"conflicts"`
+}
+
+// The MarshalJSON method promoted from Record would drop the conflicts, which are sent as an empty list
+// rather than null when there are none.
+func (d UpdateResult) MarshalJSON() ([]byte, error) {
+	conflicts := d.Conflicts
+	if conflicts == nil {
+		conflicts = []Conflict{}
+	}
+
+	return json.Marshal(struct {
+		recordWire
+		Conflicts              []Conflict          `json:"conflicts"`
+	}{ d.Record.wire(), conflicts })
+}
+
+// An interval of effective time during which an attribute of a record held a value.
+// EffectiveTo is nil while the value is still in effect. Version, ReportedTimestamp and Kind identify the
+// version that set the value.
+type FieldInterval struct {
+	Key                    string              `json:"key"`
+	Value                  string              `json:"value"`
+	EffectiveFrom          int64               `json:"effectiveFrom"`
+	EffectiveTo            *int64              `json:"effectiveTo"`
+	Version                int                 `json:"version"`
+	ReportedTimestamp      int64               `json:"reportedTimestamp"`
+	Kind                   string              `json:"kind"`
+}
+
+// EffectiveToTime is null while the value is still in effect, like EffectiveTo.
+func (d FieldInterval) MarshalJSON() ([]byte, error) {
+	type plainFieldInterval FieldInterval
+
+	var effectiveToTime *string
+	if d.EffectiveTo != nil {
+		formatted := formatTime(*d.EffectiveTo)
+		effectiveToTime = &formatted
+	}
+
+	return json.Marshal(struct {
+		plainFieldInterval
+		EffectiveFromTime      string              `json:"effectiveFromTime"`
+		EffectiveToTime        *string             `json:"effectiveToTime"`
+		ReportedTime           string              `json:"reportedTime"`
+	}{ plainFieldInterval(d), formatTime(d.EffectiveFrom), effectiveToTime, formatTime(d.ReportedTimestamp) })
+}
+
+// A key whose value differs between two versions of a record. OldValue is nil for an added key
+// and NewValue is nil for a removed key. Kind is the kind of the last version between the two that changed
+// the key.
+type FieldChange struct {
+	Key                    string              `json:"key"`
+	OldValue               *string             `json:"oldValue"`
+	NewValue               *string             `json:"newValue"`
+	Kind                   string              `json:"kind"`
+}
+
+// The difference between two versions of a record.
+type RecordDiff struct {
+	ID                     int                 `json:"id"`
+	FromVersion            int                 `json:"fromVersion"`
+	ToVersion              int                 `json:"toVersion"`
+	Added                  []FieldChange       `json:"added"`
+	Removed                []FieldChange       `json:"removed"`
+	Changed                []FieldChange       `json:"changed"`
+}
+
+// Method to compute the keys that were added, removed and changed going from this version of the record to
+// the other. Each list is sorted by key.
+func (d *Record) Diff(other Record) RecordDiff {
+
+	diff := RecordDiff{
+		ID: d.ID,
+		FromVersion: d.Version,
+		ToVersion: other.Version,
+		Added: []FieldChange{},
+		Removed: []FieldChange{},
+		Changed: []FieldChange{},
+	}
+
+	for key, oldValue := range d.Data {
+		oldValue := oldValue
+		newValue, ok := other.Data[key]
+
+		if !ok {
+			diff.Removed = append(diff.Removed, FieldChange{ Key: key, OldValue: &oldValue })
+		} else if newValue != oldValue {
+			diff.Changed = append(diff.Changed, FieldChange{ Key: key, OldValue: &oldValue, NewValue: &newValue })
+		}
+	}
+
+	for key, newValue := range other.Data {
+		newValue := newValue
+		if _, ok := d.Data[key]; !ok {
+			diff.Added = append(diff.Added, FieldChange{ Key: key, NewValue: &newValue })
+		}
+	}
+
+	for _, changes := range [][]FieldChange{ diff.Added, diff.Removed, diff.Changed } {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	}
+
+	return diff
+}
+
+// Method to mark each change of the diff with the kind of the last version that changed its key. versions are
+// the versions of the record in effective order from the earlier side of the diff to the later one.
+func (d *RecordDiff) MarkKinds(versions []Record) {
+	kinds := map[string]string{}
+
+	for i := 1; i < len(versions); i++ {
+		previous, current := versions[i-1].Data, versions[i].Data
+
+		for _, data := range []map[string]string{ previous, current } {
+			for key := range data {
+				oldValue, hadKey := previous[key]
+				newValue, hasKey := current[key]
+				if hadKey != hasKey || oldValue != newValue {
+					kinds[key] = versions[i].Kind
+				}
+			}
+		}
+	}
+
+	for _, changes := range [][]FieldChange{ d.Added, d.Removed, d.Changed } {
+		for i := range changes {
+			changes[i].Kind = kinds[changes[i].Key]
+		}
+	}
+}
+
+// Method to get the updates that turn the from side of the diff into the to side: added and changed keys
+// are set to their new values and removed keys are set to nil.
+func (d *RecordDiff) Updates() map[string]*string {
+	updates := map[string]*string{}
+
+	for _, changes := range [][]FieldChange{ d.Added, d.Changed, d.Removed } {
+		for _, change := range changes {
+			updates[change.Key] = change.NewValue
+		}
+	}
+
+	return updates
+}
+
+// A page of records. NextCursor is passed back to read the following page and is empty on the last page.
+type RecordPage struct {
+	Records                []Record            `json:"records"`
+	NextCursor             string              `json:"nextCursor"`
+}
+
+// The outcome of checking the hash chain over the history of a record. Rows counts the rows of the history and Head
+// is the hash of the latest one, which commits to the whole history. Signed is set when the head matches the head
+// the service signed; a history without a signed head is not signed, but can still be valid. The chain is valid when
+// there are no failures.
+type ChainVerification struct {
+	ID                     int                 `json:"id"`
+	Valid                  bool                `json:"valid"`
+	Signed                 bool                `json:"signed"`
+	Rows                   int                 `json:"rows"`
+	Head                   string              `json:"head"`
+	Failures               []ChainFailure      `json:"failures"`
+}
+
+// A row of the history of a record that does not check out, identified by its row id, and why. A failure that is not
+// about a single row, such as a snapshot or the signed head, has no row.
+type ChainFailure struct {
+	Row                    int64               `json:"row"`
+	Version                int                 `json:"version"`
+	Reason                 string              `json:"reason"`
+}
+
+// The records read by a batch read, and the ids of the requested records that did not exist at the requested time.
+type RecordBatch struct {
+	Records                []Record            `json:"records"`
+	Missing                []int               `json:"missing"`
+}
@@ -0,0 +1,36 @@
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Every field of a v2 record goes out under its camelCase name. A malformed struct tag is ignored by encoding/json,
+// which would send the Go field name instead.
+func TestRecordFieldNames(t *testing.T) {
+	record := Record{ ID: 1, Version: 2, EffectivePosition: 1, Revision: 3, Data: map[string]string{} }
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("could not encode the record: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("could not decode the record: %v", err)
+	}
+
+	expected := []string{
+		"id", "version", "effectivePosition", "revision", "updatedTimestamp", "reportedTimestamp", "data", "deleted",
+		"kind", "retracted", "actor", "source", "reason", "updatedTime", "reportedTime",
+	}
+	for _, name := range expected {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected the field %q in %s", name, data)
+		}
+	}
+
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d fields, got %d: %s", len(expected), len(fields), data)
+	}
+}
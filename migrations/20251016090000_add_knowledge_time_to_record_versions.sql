@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- record_versions is append-only. When a retroactive update restates a version, the
+-- old row is closed out by setting superseded_at (the knowledge time at which it stopped
+-- being believed) and the replacement row points back to it through supersedes.
+alter table record_versions add column superseded_at integer;
+
+alter table record_versions add column supersedes integer;
+
+create index idx_record_versions_superseded_at on record_versions(superseded_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_record_versions_superseded_at;
+
+alter table record_versions drop column supersedes;
+
+alter table record_versions drop column superseded_at;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- changes holds the keys a version explicitly set (or removed, as null). Retroactive updates
+-- stop propagating a key at the first later version that explicitly changed it.
+alter table record_versions add column changes text not null default '{}' check(json_valid(changes));
+
+-- Backfill the changes of existing versions by diffing each version against the version that
+-- preceded it in effective order at the time it was reported.
+update record_versions set changes = coalesce((
+       select json_group_object(key, value) from (
+              select cur.key as key, cur.value as value
+              from json_each(record_versions.attributes) as cur
+              where json_extract(coalesce((
+                    select p.attributes from record_versions as p
+                    where p.record_id = record_versions.record_id
+                    and p.created_at <= record_versions.created_at
+                    and (p.superseded_at is null or p.superseded_at > record_versions.created_at)
+                    and (p.actual_update_timestamp < record_versions.actual_update_timestamp
+                         or (p.actual_update_timestamp = record_versions.actual_update_timestamp and p.id < record_versions.id))
+                    order by p.actual_update_timestamp desc, p.id desc limit 1
+              ), '{}'), '$."' || cur.key || '"') is not cur.value
+
+              union all
+
+              select prev.key as key, null as value
+              from json_each(coalesce((
+                    select p.attributes from record_versions as p
+                    where p.record_id = record_versions.record_id
+                    and p.created_at <= record_versions.created_at
+                    and (p.superseded_at is null or p.superseded_at > record_versions.created_at)
+                    and (p.actual_update_timestamp < record_versions.actual_update_timestamp
+                         or (p.actual_update_timestamp = record_versions.actual_update_timestamp and p.id < record_versions.id))
+                    order by p.actual_update_timestamp desc, p.id desc limit 1
+              ), '{}')) as prev
+              where json_type(record_versions.attributes, '$."' || prev.key || '"') is null
+       )
+), '{}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column changes;
+-- +goose StatementEnd
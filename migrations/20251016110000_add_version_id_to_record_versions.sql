@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- version_id is the stable, per-record identifier of a version. It is assigned once when the
+-- version is written and is carried over to the rows that restate it, so inserting a back-dated
+-- version never renumbers the versions after it.
+alter table record_versions add column version_id integer;
+
+-- Number the versions of each record in the order they were first written, then give every
+-- restated row the identifier of the row it descends from.
+with recursive lineage(id, root_id) as (
+     select id, id from record_versions where supersedes is null
+     union all
+     select r.id, l.root_id from record_versions as r join lineage as l on r.supersedes = l.id
+)
+update record_versions set version_id = (
+       select count(*) from record_versions as roots
+       where roots.record_id = record_versions.record_id
+       and roots.supersedes is null
+       and roots.id <= (select root_id from lineage where lineage.id = record_versions.id)
+);
+
+create index idx_record_versions_version_id on record_versions(record_id, version_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_record_versions_version_id;
+
+alter table record_versions drop column version_id;
+-- +goose StatementEnd
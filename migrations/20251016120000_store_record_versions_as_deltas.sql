@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Versions are stored as deltas: record_versions.changes holds the keys a version set or removed,
+-- and the state of a record is rebuilt by applying the changes in effective order.
+-- record_snapshots checkpoints the rebuilt state after a version so reads only apply the changes
+-- since the latest snapshot. Snapshots are a cache of the current history and are discarded
+-- whenever a retroactive write lands before them.
+create table record_snapshots (
+id integer primary key autoincrement,
+record_id integer not null,
+version_id integer not null,
+attributes text not null default '{}' check(json_valid(attributes)),
+created_at integer not null,
+foreign key(record_id) references records(id)
+);
+
+create index idx_record_snapshots_record_id on record_snapshots(record_id, version_id);
+
+-- The full attributes of the current versions become their snapshots.
+insert into record_snapshots(record_id, version_id, attributes, created_at)
+select record_id, version_id, attributes, created_at from record_versions where superseded_at is null;
+
+alter table record_versions drop column attributes;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Only versions with a snapshot get their attributes back.
+alter table record_versions add column attributes text not null default '{}' check(json_valid(attributes));
+
+update record_versions set attributes = coalesce((
+       select s.attributes from record_snapshots as s
+       where s.record_id = record_versions.record_id and s.version_id = record_versions.version_id
+       order by s.id desc limit 1
+), '{}');
+
+drop table record_snapshots;
+-- +goose StatementEnd
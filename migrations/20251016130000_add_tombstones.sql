@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A tombstone version deletes the record from its effective time on. Reads at or after it return
+-- not found, while reads before it still see the record.
+alter table record_versions add column tombstone integer not null default 0;
+
+-- The effective time of the tombstone when the latest version of the record is one, otherwise null.
+alter table records add column deleted_at integer;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table records drop column deleted_at;
+
+alter table record_versions drop column tombstone;
+-- +goose StatementEnd
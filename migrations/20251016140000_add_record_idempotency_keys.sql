@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The idempotency keys of the writes to a record. A retried write with the same key is answered
+-- with the stored response instead of writing another version. request_hash guards against a key
+-- being reused for a different request.
+create table record_idempotency_keys (
+id integer primary key autoincrement,
+record_id integer not null,
+idempotency_key text not null,
+version_id integer not null,
+request_hash text not null,
+response text not null check(json_valid(response)),
+created_at integer not null,
+foreign key(record_id) references records(id),
+unique(record_id, idempotency_key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table record_idempotency_keys;
+-- +goose StatementEnd
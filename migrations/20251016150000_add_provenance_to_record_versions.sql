@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Who wrote each version, through which channel, and why. actor is the authenticated user that made
+-- the write. Versions written before these were recorded leave them null.
+alter table record_versions add column actor text;
+
+alter table record_versions add column source text check(source in ('portal', 'email_intake', 'underwriter'));
+
+alter table record_versions add column reason text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column reason;
+
+alter table record_versions drop column source;
+
+alter table record_versions drop column actor;
+-- +goose StatementEnd
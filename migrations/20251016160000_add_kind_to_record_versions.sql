@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Whether a version records a change in the world at its effective time, or a correction of data
+-- that was entered wrongly. A correction restates an earlier version under the same version_id:
+-- the row it replaces is closed out by superseded_at, so reads known before the correction still
+-- see the original data.
+alter table record_versions add column kind text not null default 'change' check(kind in ('change', 'correction'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column kind;
+-- +goose StatementEnd
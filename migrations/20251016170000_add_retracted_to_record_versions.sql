@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A retracted version no longer contributes to the record. Its row is closed out by superseded_at
+-- and a retraction row supersedes it, recording when and by whom it was retracted. The retraction
+-- row is closed out as soon as it is written, so it is never read as a version, while reads known
+-- before the retraction still see the original row.
+alter table record_versions add column retracted integer not null default 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column retracted;
+-- +goose StatementEnd
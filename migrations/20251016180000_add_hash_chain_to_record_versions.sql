@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The rows of each record form a hash chain in the order they were written. hash covers the
+-- contents of the row, every column but superseded_at, and prev_hash, the hash of the previous
+-- row of the record, so editing or removing a row breaks the chain from that row on.
+-- The rows written before the chain existed are hashed once, by the Go migration 20251016220000.
+alter table record_versions add column prev_hash text;
+
+alter table record_versions add column hash text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column hash;
+
+alter table record_versions drop column prev_hash;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Reads look up the current versions of a record in effective order, and listing records does it
+-- for every record it selects.
+create index idx_record_versions_current on record_versions(record_id, actual_update_timestamp, version_id) where superseded_at is null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_record_versions_current;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A version restated because a write overwrote one of its keys records the row of that write in
+-- restated_by, so retracting the write can restore what it overwrote. It is null on every other row.
+alter table record_versions add column restated_by integer references record_versions(id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table record_versions drop column restated_by;
+-- +goose StatementEnd
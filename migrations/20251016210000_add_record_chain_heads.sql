@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The head of the hash chain of every record: the number of its rows and the hash of the latest
+-- one, signed by the server with the audit signing key after every write. Rows rewritten with
+-- recomputed hashes, or removed from the end of the history, no longer match the signed head.
+create table record_chain_heads (
+record_id integer primary key,
+rows integer not null,
+head text not null,
+public_key text not null,
+signature text not null,
+signed_at integer not null,
+foreign key(record_id) references records(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table record_chain_heads;
+-- +goose StatementEnd
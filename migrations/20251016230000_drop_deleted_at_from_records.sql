@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Whether a record is deleted depends on the time it is read at, so it is always read from the
+-- tombstone versions in record_versions. deleted_at only held the latest of them and was never read.
+alter table records drop column deleted_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table records add column deleted_at integer;
+-- +goose StatementEnd
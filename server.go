@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -27,16 +30,47 @@ func logError(err error) {
 
 func main() {
 	
-	db, err := initDB()
+	db, readDB, err := initDB()
 	if err != nil {
 		log.Fatalf("The connection to the DB could not be established. Exiting the application..")
 		return
 	}
 	
+	auditKey, err := loadAuditKey()
+	if err != nil {
+		log.Fatalf("The audit signing key could not be loaded. Error: %v", err)
+	}
+
+	router := newRouter(db, readDB, auditKey)
+
+	address := "127.0.0.1:8000"
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         address,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("listening on %s", address)
+	log.Fatal(srv.ListenAndServe())
+
+	defer db.Close()
+	defer readDB.Close()
+}
+
+// The rows written before the hash chain existed are hashed once, by a Go migration that runs after the SQL
+// migrations adding the chain.
+func init() {
+	goose.AddNamedMigrationContext("20251016220000_hash_rows_written_before_the_chain.go", service.BackfillHashChain, nil)
+}
+
+// newRouter serves the v1 and v2 APIs backed by the database, writing through db and reading through readDB. Audit
+// exports and the heads of the hash chains are signed with auditKey.
+func newRouter(db *sql.DB, readDB *sql.DB, auditKey ed25519.PrivateKey) *mux.Router {
 	router := mux.NewRouter()
 
-	service := service.NewDBRecordService(db)
-	api := api.NewAPI(&service)
+	service := service.NewDBRecordService(db, readDB, auditKey)
+	api := api.NewAPI(&service, auditKey)
 
 	apiRoute := router.PathPrefix("/api/v1").Subrouter()
 	apiRoute.Path("/health").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -47,42 +81,74 @@ func main() {
 
 	apiRouteV2 := router.PathPrefix("/api/v2").Subrouter()
 	api.CreateRoutesV2(apiRouteV2)
-	
 
-	address := "127.0.0.1:8000"
-	srv := &http.Server{
-		Handler:      router,
-		Addr:         address,
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+	return router
+}
+
+// The environment variable holding the key that signs audit exports, as the base64 encoding of a 32-byte Ed25519
+// seed.
+const auditKeyEnv = "AUDIT_SIGNING_KEY"
+
+// Load the key that signs audit exports. Without the environment variable there is no key, and audit exports are
+// unavailable.
+func loadAuditKey() (ed25519.PrivateKey, error) {
+	encoded := os.Getenv(auditKeyEnv)
+	if encoded == "" {
+		log.Printf("%s is not set; audit exports are unavailable", auditKeyEnv)
+		return nil, nil
 	}
 
-	log.Printf("listening on %s", address)
-	log.Fatal(srv.ListenAndServe())
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s must be the base64 encoding of a %d-byte Ed25519 seed", auditKeyEnv, ed25519.SeedSize)
+	}
 
-	defer db.Close()
+	key := ed25519.NewKeyFromSeed(seed)
+	log.Printf("Audit exports are signed with the public key: %s", base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	return key, nil
 }
 
-func initDB() (*sql.DB, error) {
+// Open the pools that write to and read from the database, and migrate it.
+func initDB() (*sql.DB, *sql.DB, error) {
 
-	db, err := connectToDB()
+	db, err := connectToDB("insurance_data.db")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if err := performDBMigration(db); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return db, nil
+	readDB, err := connectToReadDB("insurance_data.db")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, readDB, nil
 
 }
 
-func connectToDB() (*sql.DB, error) {
+// The connection waits up to busyTimeout milliseconds for a lock held by another connection.
+const busyTimeout = 5000
 
-	dbName := "insurance_data.db"
+// Open the pool that writes to the database. The database is put in WAL mode, so readers and the writer do not block
+// each other. Write transactions begin immediate, taking the write lock up front, so concurrent writers queue up
+// instead of failing when they upgrade from a read lock.
+func connectToDB(dbName string) (*sql.DB, error) {
+	return openDB(fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL&_txlock=immediate", dbName, busyTimeout))
+}
+
+// Open the pool that reads from the database. go-sqlite3 begins every transaction of a pool with the lock of its
+// DSN, whatever the sql.TxOptions, so read-only transactions need a pool of their own that begins them deferred.
+// Its connections are query only.
+func connectToReadDB(dbName string) (*sql.DB, error) {
+	return openDB(fmt.Sprintf("%s?_busy_timeout=%d&_txlock=deferred&_query_only=true", dbName, busyTimeout))
+}
 
-	db, err := sql.Open("sqlite3", dbName)
+func openDB(dsn string) (*sql.DB, error) {
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		log.Fatalf("The database could not be opened. Error: %v", err)
 		return nil, err
@@ -104,7 +170,7 @@ var embedMigrations embed.FS
 func performDBMigration(db *sql.DB) (error) {
 
 	if err := goose.SetDialect("sqlite3"); err != nil {
-		log.Fatal("SQL dialect could not be selected. Error: %v", err)
+		log.Fatalf("SQL dialect could not be selected. Error: %v", err)
 	}
 
 	log.Println("SQLite: Initializing Goose for SQLite..")
@@ -121,5 +187,6 @@ func performDBMigration(db *sql.DB) (error) {
 	}
 
 	log.Println("SQLite: The SQL migrations have been successfully completed !")
+
 	return nil
 }
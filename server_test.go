@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rainbowmga/timetravel/service"
+)
+
+// Many first writes to the same id race to create the record. Exactly one of them must create it, and every
+// other write must be applied on top of it without losing any key.
+func TestConcurrentWritesToOneRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "insurance_data.db")
+	db, err := connectToDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	defer db.Close()
+
+	if err := performDBMigration(db); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	readDB, err := connectToReadDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database for reads: %v", err)
+	}
+	defer readDB.Close()
+
+	records := service.NewDBRecordService(db, readDB, nil)
+	ctx := context.Background()
+
+	const writers = 50
+	const id = 1
+	updatedTimestamp := time.Now().Unix()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			value := fmt.Sprint(i)
+			updates := map[string]*string{ fmt.Sprintf("writer%d", i): &value }
+			_, err := records.WriteRecord(ctx, id, updatedTimestamp, updates, service.UpdateOptions{})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("write failed: %v", err)
+		}
+	}
+
+	versions, err := records.GetVersions(ctx, id)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	if len(versions) != writers {
+		t.Fatalf("expected %d versions, got %d", writers, len(versions))
+	}
+
+	for position, version := range versions {
+		if version.Version != position+1 {
+			t.Errorf("expected version %d at position %d, got %d", position+1, position+1, version.Version)
+		}
+	}
+
+	record, err := records.GetRecord(ctx, id)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+
+	for i := 0; i < writers; i++ {
+		key := fmt.Sprintf("writer%d", i)
+		if record.Data[key] != fmt.Sprint(i) {
+			t.Errorf("expected %s to be %d, got %q", key, i, record.Data[key])
+		}
+	}
+}
+
+// The rows written before the hash chain existed are hashed once, by a migration. Starting again must not hash a row
+// whose hash was removed since, which would hide the tampering from verification.
+func TestMigrationDoesNotRehashRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "insurance_data.db")
+	db, err := connectToDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	defer db.Close()
+
+	if err := performDBMigration(db); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	readDB, err := connectToReadDB(path)
+	if err != nil {
+		t.Fatalf("could not open the database for reads: %v", err)
+	}
+	defer readDB.Close()
+
+	records := service.NewDBRecordService(db, readDB, nil)
+	ctx := context.Background()
+
+	value := "1"
+	if _, err := records.WriteRecord(ctx, 1, 100, map[string]*string{ "a": &value }, service.UpdateOptions{}); err != nil {
+		t.Fatalf("could not write the record: %v", err)
+	}
+
+	if _, err := db.Exec(`update record_versions set changes = '{"a":"tampered"}', hash = null where record_id = 1`); err != nil {
+		t.Fatalf("could not tamper with the record: %v", err)
+	}
+
+	if err := performDBMigration(db); err != nil {
+		t.Fatalf("could not migrate the database again: %v", err)
+	}
+
+	verification, err := records.VerifyRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if verification.Valid {
+		t.Errorf("expected the tampered history to fail verification after starting again")
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Export the full history of the record for an audit: the versions as currently known, every row ever written for
+// it and the verification of its history, as VerifyRecord reports it. Everything is read in one read-only transaction, so the
+// parts of the export agree with each other even while the record is being written.
+func (s *DBRecordService) ExportRecord(ctx context.Context, id int) (_ entity.AuditDocument, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	log.Println("Exporting the history of the record with id: ", id)
+
+	tx, err := s.readDB.BeginTx(ctx, &sql.TxOptions{ ReadOnly: true })
+	if err != nil {
+		return entity.AuditDocument{}, err
+	}
+	defer tx.Rollback()
+
+	versions, err := getVersions(ctx, tx, id)
+	if err != nil {
+		return entity.AuditDocument{}, err
+	}
+
+	chain, err := readChain(ctx, tx, id)
+	if err != nil {
+		return entity.AuditDocument{}, err
+	}
+
+	verification, err := s.verifyHistory(ctx, tx, id, chain)
+	if err != nil {
+		return entity.AuditDocument{}, err
+	}
+
+	if !verification.Valid {
+		log.Println("The history of the record with id: ", id, " is exported with a broken hash chain.")
+	}
+
+	return entity.NewAuditDocument(id, time.Now().Unix(), versions, chain, verification), nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Read several records in one read-only transaction, so that every record is read from the same state of the db
+// even while other requests are writing. The transaction does not take the write lock, so it neither waits for
+// writers nor holds them up.
+// Records that did not exist or were deleted at the requested time are reported as missing.
+func (s *DBRecordService) BatchGetRecords(ctx context.Context, opts BatchGetOptions) (_ entity.RecordBatch, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	log.Println("Reading ", len(opts.IDs), " records at: ", opts.At, " known at: ", opts.KnownAt)
+
+	batch := entity.RecordBatch{ Records: []entity.Record{}, Missing: []int{} }
+
+	tx, err := s.readDB.BeginTx(ctx, &sql.TxOptions{ ReadOnly: true })
+	if err != nil {
+		return entity.RecordBatch{}, err
+	}
+	defer tx.Rollback()
+
+	for _, id := range opts.IDs {
+		var record entity.Record
+		if opts.KnownAt == 0 {
+			record, err = s.getRecordAt(ctx, tx, id, opts.At)
+			if err == nil && record.Deleted {
+				err = ErrRecordDeleted
+			}
+		} else {
+			record, err = s.getRecordAsOf(ctx, tx, id, opts.At, opts.KnownAt)
+		}
+
+		if errors.Is(err, ErrRecordDoesNotExist) {
+			batch.Missing = append(batch.Missing, id)
+			continue
+		}
+		if err != nil {
+			return entity.RecordBatch{}, err
+		}
+
+		batch.Records = append(batch.Records, record)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.RecordBatch{}, err
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Build the row of a version for insertion.
+func newChainedVersion(id int, versionId int, updatedTimestamp int64, createdAt int64, changes []byte, provenance entity.Provenance, kind string) entity.ChainedVersion {
+	return entity.ChainedVersion{
+		RecordId: id,
+		VersionId: versionId,
+		UpdatedTimestamp: updatedTimestamp,
+		CreatedAt: createdAt,
+		Changes: string(changes),
+		Actor: provenance.Actor,
+		Source: provenance.Source,
+		Reason: provenance.Reason,
+		Kind: kind,
+	}
+}
+
+// Append a row to record_versions, chained to the latest row of the record, and return its id. supersededAt is null
+// unless the row is closed out as it is written.
+func (s *DBRecordService) insertVersionRow(ctx context.Context, tx *sql.Tx, row entity.ChainedVersion, supersededAt sql.NullInt64) (int64, error) {
+
+	query := "select coalesce(hash, '') from record_versions where record_id = ? order by id desc limit 1"
+	err := tx.QueryRowContext(ctx, query, row.RecordId).Scan(&row.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	hash, err := row.Hash()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into record_versions(record_id, version_id, actual_update_timestamp, created_at, superseded_at, supersedes, restated_by, changes,
+		tombstone, actor, source, reason, kind, retracted, prev_hash, hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt, row.RecordId, row.VersionId, row.UpdatedTimestamp, row.CreatedAt, supersededAt, nullInt64(row.Supersedes),
+		nullInt64(row.RestatedBy), row.Changes, row.Tombstone, nullString(row.Actor), nullString(row.Source), nullString(row.Reason), row.Kind, row.Retracted,
+		nullString(row.PrevHash), hash)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.signChainHead(ctx, tx, row.RecordId, row.PrevHash, hash); err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// A head of the hash chain of a record as stored in record_chain_heads, with the key that signed it.
+type signedChainHead struct {
+	entity.ChainHead
+	PublicKey   string
+	Signature   string
+}
+
+// Read the signed head of the record. The second return value reports whether the record has one.
+func readSignedHead(ctx context.Context, q querier, id int) (signedChainHead, bool, error) {
+
+	query := "select rows, head, public_key, signature from record_chain_heads where record_id = ?"
+	row := q.QueryRowContext(ctx, query, id)
+
+	head := signedChainHead{ ChainHead: entity.ChainHead{ RecordId: id } }
+	err := row.Scan(&head.Rows, &head.Head, &head.PublicKey, &head.Signature)
+	if err == sql.ErrNoRows {
+		return signedChainHead{}, false, nil
+	}
+	return head, err == nil, err
+}
+
+// Sign the head of the hash chain of the record after a row with hash was appended to it after the row with prevHash.
+// The head is only moved on from a head this key signed if that head is the row before, so a history that was
+// rewritten or cut short outside the service is never signed over and keeps failing verification. Nothing is signed
+// without a key.
+func (s *DBRecordService) signChainHead(ctx context.Context, tx *sql.Tx, id int, prevHash string, hash string) error {
+	if s.headKey == nil {
+		return nil
+	}
+
+	var rows int
+	if err := tx.QueryRowContext(ctx, "select count(*) from record_versions where record_id = ?", id).Scan(&rows); err != nil {
+		return err
+	}
+
+	publicKey := base64.StdEncoding.EncodeToString(s.headKey.Public().(ed25519.PublicKey))
+
+	signed, found, err := readSignedHead(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	previous := entity.ChainHead{ RecordId: id, Rows: rows - 1, Head: prevHash }
+	if found && signed.PublicKey == publicKey && (signed.ChainHead != previous || !signed.VerifySignature(s.headKey.Public().(ed25519.PublicKey), signed.Signature)) {
+		log.Println("The history of the record with id: ", id, " does not match its signed head; the head is left as it was.")
+		return nil
+	}
+
+	head := entity.ChainHead{ RecordId: id, Rows: rows, Head: hash }
+	signature, err := head.Sign(s.headKey)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into record_chain_heads(record_id, rows, head, public_key, signature, signed_at) values (?, ?, ?, ?, ?, ?)
+		on conflict(record_id) do update set rows = excluded.rows, head = excluded.head, public_key = excluded.public_key,
+		signature = excluded.signature, signed_at = excluded.signed_at`
+	_, err = tx.ExecContext(ctx, stmt, id, head.Rows, head.Head, publicKey, signature, time.Now().Unix())
+	return err
+}
+
+// Store a nil row id as null.
+func nullInt64(value *int64) sql.NullInt64 {
+	if value == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{ Int64: *value, Valid: true }
+}
+
+// Read every row of the record in the order it was written.
+func readChain(ctx context.Context, q querier, id int) ([]entity.AuditRow, error) {
+
+	query := `select id, record_id, version_id, actual_update_timestamp, created_at, superseded_at, supersedes, restated_by, changes, tombstone,
+		actor, source, reason, kind, retracted, prev_hash, hash from record_versions where record_id = ? order by id asc`
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chain := []entity.AuditRow{}
+	for rows.Next() {
+		var row entity.AuditRow
+		var supersededAt, supersedes, restatedBy sql.NullInt64
+		var actor, source, reason, prevHash, hash sql.NullString
+
+		err := rows.Scan(&row.Row, &row.RecordId, &row.VersionId, &row.UpdatedTimestamp, &row.CreatedAt, &supersededAt, &supersedes,
+			&restatedBy, &row.Changes, &row.Tombstone, &actor, &source, &reason, &row.Kind, &row.Retracted, &prevHash, &hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if supersededAt.Valid {
+			row.SupersededAt = &supersededAt.Int64
+		}
+		if supersedes.Valid {
+			row.Supersedes = &supersedes.Int64
+		}
+		if restatedBy.Valid {
+			row.RestatedBy = &restatedBy.Int64
+		}
+		row.Actor, row.Source, row.Reason = actor.String, source.String, reason.String
+		row.PrevHash, row.Hash = prevHash.String, hash.String
+
+		chain = append(chain, row)
+	}
+
+	return chain, rows.Err()
+}
+
+// Verify the history of the record: the hash chain over every row of it, as entity.VerifyChain describes, the
+// snapshots that reads start from, and the head the service signed. Everything is read in one read-only transaction.
+func (s *DBRecordService) VerifyRecord(ctx context.Context, id int) (_ entity.ChainVerification, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	log.Println("Verifying the history of the record with id: ", id)
+
+	tx, err := s.readDB.BeginTx(ctx, &sql.TxOptions{ ReadOnly: true })
+	if err != nil {
+		return entity.ChainVerification{}, err
+	}
+	defer tx.Rollback()
+
+	chain, err := readChain(ctx, tx, id)
+	if err != nil {
+		return entity.ChainVerification{}, err
+	}
+
+	if len(chain) == 0 {
+		return entity.ChainVerification{}, ErrRecordDoesNotExist
+	}
+
+	verification, err := s.verifyHistory(ctx, tx, id, chain)
+	if err != nil {
+		return entity.ChainVerification{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.ChainVerification{}, err
+	}
+
+	if !verification.Valid {
+		log.Println("The history of the record with id: ", id, " failed verification with ", len(verification.Failures), " failures.")
+	}
+	return verification, nil
+}
+
+// Verify the rows of the history of the record in chain, its snapshots and its signed head.
+func (s *DBRecordService) verifyHistory(ctx context.Context, q querier, id int, chain []entity.AuditRow) (entity.ChainVerification, error) {
+
+	verification, err := entity.VerifyChain(id, chain)
+	if err != nil {
+		return entity.ChainVerification{}, err
+	}
+
+	failures, err := verifySnapshots(ctx, q, id)
+	if err != nil {
+		return entity.ChainVerification{}, err
+	}
+	verification.Failures = append(verification.Failures, failures...)
+
+	// A chain without a head signed with the key, hashed by the migration or last written without the key, is only
+	// reported as unsigned. A signed head that does not match the chain is a failure.
+	if s.headKey != nil {
+		signed, failure, err := verifySignedHead(ctx, q, id, verification, s.headKey.Public().(ed25519.PublicKey))
+		if err != nil {
+			return entity.ChainVerification{}, err
+		}
+
+		if failure != "" {
+			verification.Failures = append(verification.Failures, entity.ChainFailure{ Reason: failure })
+		}
+		verification.Signed = signed && failure == ""
+	}
+
+	verification.Valid = len(verification.Failures) == 0
+	return verification, nil
+}
+
+// Check the snapshots of the record against its data rebuilt from the changes of its versions alone. Snapshots are not
+// part of the hash chain, but reads start from them, so an edited snapshot would change what the record reads as.
+func verifySnapshots(ctx context.Context, q querier, id int) ([]entity.ChainFailure, error) {
+
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and superseded_at is null order by actual_update_timestamp asc, version_id asc"
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data of the record as of each current version.
+	states := map[int]map[string]string{}
+	data := map[string]string{}
+	for _, version := range versions {
+		applyVersion(data, version)
+
+		state := map[string]string{}
+		for key, value := range data {
+			state[key] = value
+		}
+		states[version.VersionId] = state
+	}
+
+	rows, err = q.QueryContext(ctx, "select id, version_id, attributes from record_snapshots where record_id = ? order by id asc", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []entity.ChainFailure{}
+	for rows.Next() {
+		var snapshotId int64
+		var versionId int
+		var attributesStr string
+		if err := rows.Scan(&snapshotId, &versionId, &attributesStr); err != nil {
+			return nil, err
+		}
+
+		// Reads only start from the snapshots of current versions.
+		state, ok := states[versionId]
+		if !ok {
+			continue
+		}
+
+		attributes := map[string]string{}
+		if err := json.Unmarshal([]byte(attributesStr), &attributes); err != nil || !sameData(attributes, state) {
+			reason := fmt.Sprintf("snapshot %d does not match the data rebuilt from the versions", snapshotId)
+			failures = append(failures, entity.ChainFailure{ Version: versionId, Reason: reason })
+		}
+	}
+
+	return failures, rows.Err()
+}
+
+// Report whether two states of a record hold the same keys and values.
+func sameData(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the verified chain against the head of the record signed with publicKey. It reports whether the record has a
+// head signed with the key, and why that head does not match the chain, or an empty string when it does.
+func verifySignedHead(ctx context.Context, q querier, id int, verification entity.ChainVerification, publicKey ed25519.PublicKey) (bool, string, error) {
+
+	signed, found, err := readSignedHead(ctx, q, id)
+	if err != nil {
+		return false, "", err
+	}
+
+	switch {
+	case !found || signed.PublicKey != base64.StdEncoding.EncodeToString(publicKey):
+		return false, "", nil
+	case !signed.VerifySignature(publicKey, signed.Signature):
+		return true, "the signature of the head of the chain does not match it", nil
+	case signed.Rows != verification.Rows || signed.Head != verification.Head:
+		return true, fmt.Sprintf("the chain has %d rows ending in %s, but the signed head has %d rows ending in %s", verification.Rows, verification.Head, signed.Rows, signed.Head), nil
+	}
+	return true, "", nil
+}
+
+// Hash the rows written before the hash chain existed, chaining each of them to the row written before it. This runs
+// once, as a migration in the transaction tx. Afterwards a row without a hash fails verification and is never hashed.
+func BackfillHashChain(ctx context.Context, tx *sql.Tx) error {
+
+	rows, err := tx.QueryContext(ctx, "select distinct record_id from record_versions where hash is null")
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := backfillRecordChain(ctx, tx, id); err != nil {
+			return fmt.Errorf("hash the history of record %d: %w", id, err)
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Println("Hashed the history of ", len(ids), " records written before the hash chain.")
+	}
+	return nil
+}
+
+func backfillRecordChain(ctx context.Context, tx *sql.Tx, id int) error {
+
+	chain, err := readChain(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	prevHash := ""
+	for _, row := range chain {
+		if row.Hash == "" {
+			row.PrevHash = prevHash
+
+			row.Hash, err = row.ChainedVersion.Hash()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "update record_versions set prev_hash = ?, hash = ? where id = ?", nullString(row.PrevHash), row.Hash, row.Row)
+			if err != nil {
+				return err
+			}
+		}
+		prevHash = row.Hash
+	}
+
+	return nil
+}
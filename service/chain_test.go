@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// Write a record with three versions and return the ids of its rows in the order they were written.
+func writeChain(t *testing.T, s *DBRecordService, db *sql.DB, id int) []int64 {
+	t.Helper()
+
+	write(t, s, id, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, id, 200, set(map[string]string{ "a": "2" }), UpdateOptions{})
+	write(t, s, id, 300, set(map[string]string{ "a": "3" }), UpdateOptions{})
+
+	rows, err := db.Query("select id from record_versions where record_id = ? order by id asc", id)
+	if err != nil {
+		t.Fatalf("could not read the rows: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var rowId int64
+		if err := rows.Scan(&rowId); err != nil {
+			t.Fatalf("could not read the rows: %v", err)
+		}
+		ids = append(ids, rowId)
+	}
+	return ids
+}
+
+// Run a statement against the database the way someone with SQL access would, outside the service.
+func tamper(t *testing.T, db *sql.DB, stmt string, args ...interface{}) {
+	t.Helper()
+
+	if _, err := db.Exec(stmt, args...); err != nil {
+		t.Fatalf("could not tamper with the database: %v", err)
+	}
+}
+
+// Check that the history of the record fails verification, with a failure that mentions reason.
+func expectInvalid(t *testing.T, s *DBRecordService, id int, reason string) {
+	t.Helper()
+
+	verification, err := s.VerifyRecord(context.Background(), id)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if verification.Valid {
+		t.Fatalf("expected the history to fail verification")
+	}
+	for _, failure := range verification.Failures {
+		if strings.Contains(failure.Reason, reason) {
+			return
+		}
+	}
+	t.Errorf("expected a failure mentioning %q, got %+v", reason, verification.Failures)
+}
+
+func TestVerifyUntamperedHistory(t *testing.T) {
+	s, db := newTestService(t)
+	writeChain(t, s, db, 1)
+
+	verification, err := s.VerifyRecord(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid || !verification.Signed || verification.Rows != 3 {
+		t.Errorf("expected a valid, signed history of 3 rows, got %+v", verification)
+	}
+}
+
+func TestVerifyDetectsTamperedRow(t *testing.T) {
+	s, db := newTestService(t)
+	rows := writeChain(t, s, db, 1)
+
+	tamper(t, db, `update record_versions set changes = '{"a":"tampered"}' where id = ?`, rows[1])
+
+	expectInvalid(t, s, 1, "the hash does not match the contents of the row")
+}
+
+// Rewriting a row and recomputing every hash after it leaves a consistent chain, which only the signed head catches.
+func TestVerifyDetectsRehashedHistory(t *testing.T) {
+	s, db := newTestService(t)
+	rows := writeChain(t, s, db, 1)
+
+	tamper(t, db, `update record_versions set changes = '{"a":"tampered"}' where id = ?`, rows[1])
+	tamper(t, db, "update record_versions set prev_hash = null, hash = null where record_id = ?", 1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin the transaction: %v", err)
+	}
+	if err := BackfillHashChain(context.Background(), tx); err != nil {
+		t.Fatalf("could not hash the rows: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not commit the transaction: %v", err)
+	}
+
+	expectInvalid(t, s, 1, "the signed head has 3 rows")
+
+	// A write through the service does not sign over the rewritten history.
+	write(t, s, 1, 400, set(map[string]string{ "a": "4" }), UpdateOptions{})
+	expectInvalid(t, s, 1, "the signed head has 3 rows")
+}
+
+func TestVerifyDetectsRemovedRow(t *testing.T) {
+	s, db := newTestService(t)
+	rows := writeChain(t, s, db, 1)
+
+	tamper(t, db, "delete from record_versions where id = ?", rows[1])
+
+	expectInvalid(t, s, 1, "the previous hash does not match the hash of the previous row")
+}
+
+// Removing the latest rows leaves a valid chain that ends early, which only the signed head catches.
+func TestVerifyDetectsRemovedLatestRow(t *testing.T) {
+	s, db := newTestService(t)
+	rows := writeChain(t, s, db, 1)
+
+	tamper(t, db, "delete from record_versions where id = ?", rows[2])
+
+	expectInvalid(t, s, 1, "the chain has 2 rows")
+}
+
+// A history without a signed head, like one last written without the key, is reported as unsigned, not as invalid.
+func TestVerifyReportsRemovedHeadAsUnsigned(t *testing.T) {
+	s, db := newTestService(t)
+	writeChain(t, s, db, 1)
+
+	tamper(t, db, "delete from record_chain_heads where record_id = ?", 1)
+
+	verification, err := s.VerifyRecord(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid || verification.Signed {
+		t.Errorf("expected a valid, unsigned history, got %+v", verification)
+	}
+}
+
+// superseded_at is set after a row is written, so it is outside the hash of the row, and is checked against the rows
+// that supersede it instead.
+func TestVerifyDetectsForgedSupersededAt(t *testing.T) {
+	s, db := newTestService(t)
+	rows := writeChain(t, s, db, 1)
+
+	// Closing out a current row hides its version from every read.
+	tamper(t, db, "update record_versions set superseded_at = created_at where id = ?", rows[2])
+
+	expectInvalid(t, s, 1, "the row is closed out but no row supersedes it")
+}
+
+func TestVerifyDetectsEditedSnapshot(t *testing.T) {
+	s, db := newTestService(t)
+
+	for i := 1; i <= SnapshotInterval; i++ {
+		write(t, s, 1, int64(i*100), set(map[string]string{ "a": string(rune('a' + i)) }), UpdateOptions{})
+	}
+
+	var snapshots int
+	if err := db.QueryRow("select count(*) from record_snapshots where record_id = ?", 1).Scan(&snapshots); err != nil {
+		t.Fatalf("could not count the snapshots: %v", err)
+	}
+	if snapshots == 0 {
+		t.Fatalf("expected the record to be snapshotted after %d versions", SnapshotInterval)
+	}
+
+	tamper(t, db, `update record_snapshots set attributes = '{"a":"tampered"}' where record_id = ?`, 1)
+
+	expectInvalid(t, s, 1, "does not match the data rebuilt from the versions")
+}
+
+// The rows written before the hash chain existed are hashed by the migration, and a row without a hash fails
+// verification afterwards instead of being hashed again.
+func TestBackfillHashChain(t *testing.T) {
+	s, db := newTestService(t)
+	writeChain(t, s, db, 1)
+
+	// The rows as they were written before the chain, which had neither hashes nor a signed head.
+	tamper(t, db, "update record_versions set prev_hash = null, hash = null where record_id = ?", 1)
+	tamper(t, db, "delete from record_chain_heads where record_id = ?", 1)
+	expectInvalid(t, s, 1, "the row has no hash")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin the transaction: %v", err)
+	}
+	if err := BackfillHashChain(context.Background(), tx); err != nil {
+		t.Fatalf("could not hash the rows: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not commit the transaction: %v", err)
+	}
+
+	// The hashed history is valid with the key set, but its head is not signed.
+	verification, err := s.VerifyRecord(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid || verification.Signed {
+		t.Errorf("expected a valid, unsigned history, got %+v", verification)
+	}
+
+	// The next write signs the head of the hashed history.
+	write(t, s, 1, 400, set(map[string]string{ "a": "4" }), UpdateOptions{})
+	verification, err = s.VerifyRecord(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid || !verification.Signed {
+		t.Errorf("expected a valid, signed history, got %+v", verification)
+	}
+
+	// Reads and writes never hash a row again.
+	tamper(t, db, "update record_versions set hash = null where record_id = ? and version_id = 2", 1)
+	write(t, s, 1, 500, set(map[string]string{ "a": "5" }), UpdateOptions{})
+	expectInvalid(t, s, 1, "the row has no hash")
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Write the history a back-dated update at 200 is resolved against: a first version at 100 that sets every key, a
+// version at 300 that changes every key but c, and a version at 500 that changes a. It returns the version
+// identifiers of the versions at 300 and 500.
+func writeLaterVersions(t *testing.T, s *DBRecordService) (int, int) {
+	t.Helper()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1", "b": "1", "c": "1", "d": "1", "e": "1" }), UpdateOptions{})
+	second := write(t, s, 1, 300, set(map[string]string{ "a": "3", "b": "3", "d": "3", "e": "3" }), UpdateOptions{})
+	third := write(t, s, 1, 500, set(map[string]string{ "a": "5" }), UpdateOptions{})
+	return second.Version, third.Version
+}
+
+// The back-dated update resolved against the versions written by writeLaterVersions.
+var backdatedUpdate = set(map[string]string{ "a": "x", "b": "x", "c": "x", "d": "x", "e": "x" })
+
+// A conflict reduced to what the tests compare: the later version, the key and the two values.
+type conflictRef struct {
+	Version            int
+	Key                string
+	RetroactiveValue   string
+	LaterValue         string
+}
+
+// Reduce conflicts to conflictRefs.
+func refs(conflicts []entity.Conflict) []conflictRef {
+	refs := []conflictRef{}
+	for _, conflict := range conflicts {
+		refs = append(refs, conflictRef{ conflict.Version, conflict.Key, *conflict.RetroactiveValue, *conflict.LaterValue })
+	}
+	return refs
+}
+
+// Check that the conflicts are exactly the expected ones, in order.
+func expectConflicts(t *testing.T, conflicts []conflictRef, expected []conflictRef) {
+	t.Helper()
+
+	if fmt.Sprint(conflicts) != fmt.Sprint(expected) {
+		t.Errorf("expected the conflicts %v, got %v", expected, conflicts)
+	}
+}
+
+// Check the data of every version of the record, by effective time.
+func expectVersionData(t *testing.T, s *DBRecordService, expected map[int64]map[string]string) {
+	t.Helper()
+
+	versions, err := s.GetVersions(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d versions, got %d", len(expected), len(versions))
+	}
+	for _, version := range versions {
+		expectData(t, fmt.Sprintf("the version at %d", version.UpdatedTimestamp), version.Data, expected[version.UpdatedTimestamp])
+	}
+}
+
+// With skip, each back-dated key reaches forward until the first later version that changed it, which keeps its own
+// change. A key no later version changed reaches every later version.
+func TestBackdatedUpdateSkipsConflicts(t *testing.T) {
+	s, _ := newTestService(t)
+	second, _ := writeLaterVersions(t, s)
+
+	result := write(t, s, 1, 200, backdatedUpdate, UpdateOptions{ OnConflict: ConflictSkip })
+
+	expectConflicts(t, refs(result.Conflicts), []conflictRef{
+		{ second, "a", "x", "3" }, { second, "b", "x", "3" }, { second, "d", "x", "3" }, { second, "e", "x", "3" },
+	})
+	expectVersionData(t, s, map[int64]map[string]string{
+		100: { "a": "1", "b": "1", "c": "1", "d": "1", "e": "1" },
+		200: { "a": "x", "b": "x", "c": "x", "d": "x", "e": "x" },
+		300: { "a": "3", "b": "3", "c": "x", "d": "3", "e": "3" },
+		500: { "a": "5", "b": "3", "c": "x", "d": "3", "e": "3" },
+	})
+}
+
+// With overwrite, the back-dated keys reach through every later version, which are restated without their own
+// changes to them.
+func TestBackdatedUpdateOverwritesConflicts(t *testing.T) {
+	s, _ := newTestService(t)
+	second, third := writeLaterVersions(t, s)
+
+	result := write(t, s, 1, 200, backdatedUpdate, UpdateOptions{ OnConflict: ConflictOverwrite })
+
+	expectConflicts(t, refs(result.Conflicts), []conflictRef{
+		{ second, "a", "x", "3" }, { second, "b", "x", "3" }, { second, "d", "x", "3" }, { second, "e", "x", "3" },
+		{ third, "a", "x", "5" },
+	})
+	expectVersionData(t, s, map[int64]map[string]string{
+		100: { "a": "1", "b": "1", "c": "1", "d": "1", "e": "1" },
+		200: { "a": "x", "b": "x", "c": "x", "d": "x", "e": "x" },
+		300: { "a": "x", "b": "x", "c": "x", "d": "x", "e": "x" },
+		500: { "a": "x", "b": "x", "c": "x", "d": "x", "e": "x" },
+	})
+
+	// The restated versions keep their identifiers.
+	record, err := s.GetVersionedRecord(context.Background(), 1, third)
+	if err != nil {
+		t.Fatalf("could not read version %d: %v", third, err)
+	}
+	if record.UpdatedTimestamp != 500 {
+		t.Errorf("expected version %d to stay effective at 500, got %d", third, record.UpdatedTimestamp)
+	}
+}
+
+// With reject, an update that conflicts with a later version is not written, and the conflicts are reported.
+func TestBackdatedUpdateRejectsConflicts(t *testing.T) {
+	s, _ := newTestService(t)
+	second, _ := writeLaterVersions(t, s)
+
+	result, err := s.WriteRecord(context.Background(), 1, 200, backdatedUpdate, UpdateOptions{ OnConflict: ConflictReject })
+	if !errors.Is(err, ErrUpdateConflict) {
+		t.Fatalf("expected ErrUpdateConflict, got %v", err)
+	}
+
+	expectConflicts(t, refs(result.Conflicts), []conflictRef{
+		{ second, "a", "x", "3" }, { second, "b", "x", "3" }, { second, "d", "x", "3" }, { second, "e", "x", "3" },
+	})
+	expectVersionData(t, s, map[int64]map[string]string{
+		100: { "a": "1", "b": "1", "c": "1", "d": "1", "e": "1" },
+		300: { "a": "3", "b": "3", "c": "1", "d": "3", "e": "3" },
+		500: { "a": "5", "b": "3", "c": "1", "d": "3", "e": "3" },
+	})
+
+	// An update that conflicts with nothing is written.
+	result = write(t, s, 1, 200, set(map[string]string{ "c": "x" }), UpdateOptions{ OnConflict: ConflictReject })
+	if len(result.Conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", result.Conflicts)
+	}
+}
+
+// A back-dated removal is a change like any other: it reaches forward until a later version sets the key again.
+func TestBackdatedRemovalPropagates(t *testing.T) {
+	s, _ := newTestService(t)
+	writeLaterVersions(t, s)
+
+	write(t, s, 1, 200, map[string]*string{ "a": nil, "c": nil }, UpdateOptions{})
+
+	expectVersionData(t, s, map[int64]map[string]string{
+		100: { "a": "1", "b": "1", "c": "1", "d": "1", "e": "1" },
+		200: { "b": "1", "d": "1", "e": "1" },
+		300: { "a": "3", "b": "3", "d": "3", "e": "3" },
+		500: { "a": "5", "b": "3", "d": "3", "e": "3" },
+	})
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Correct the version of the record in effect at updatedTimestamp, inside the transaction tx.
+// A correction does not append a version: the corrected version is restated under the same version identifier and
+// effective time, with updates applied to its changes, and the row it replaces is closed out as of knownAt. Reads
+// known before knownAt still see the data as it was first entered. The corrected keys reach forward into later
+// versions like a back-dated update, and the later versions that changed them are resolved by opts.OnConflict.
+func (s *DBRecordService) correctRecord(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, knownAt int64, updates map[string]*string, opts UpdateOptions) (entity.UpdateResult, error) {
+
+	query := `select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions
+		where record_id = ? and actual_update_timestamp <= ? and superseded_at is null
+		order by actual_update_timestamp desc, version_id desc limit 1`
+	rows, err := tx.QueryContext(ctx, query, id, updatedTimestamp)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if len(versions) == 0 {
+		return entity.UpdateResult{}, beforeFirstVersionError(ctx, tx, id, updatedTimestamp)
+	}
+	version := versions[0]
+
+	// A deletion is undone with an undelete, not corrected.
+	if version.Tombstone {
+		return entity.UpdateResult{}, ErrRecordDeleted
+	}
+
+	revision, err := currentRevision(ctx, tx, id)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if len(opts.IfMatch) > 0 && !containsRevision(opts.IfMatch, revision) {
+		log.Println("The correction to the record with id: ", id, " was rejected because the record is at revision: ", revision)
+		return entity.UpdateResult{}, ErrPreconditionFailed
+	}
+
+	for key, value := range updates {
+		version.Changes[key] = value
+	}
+
+	changesJsonData, err := json.Marshal(version.Changes)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	closeStmt := "update record_versions set superseded_at = ? where id = ? and superseded_at is null"
+	_, err = tx.ExecContext(ctx, closeStmt, knownAt, version.RowId)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	row := newChainedVersion(id, version.VersionId, version.UpdatedTimestamp, knownAt, changesJsonData, opts.Provenance, entity.KindCorrection)
+	row.Supersedes = &version.RowId
+
+	rowId, err := s.insertVersionRow(ctx, tx, row, sql.NullInt64{})
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	conflicts, err := s.ResolveLaterConflicts(ctx, tx, id, version.UpdatedTimestamp, knownAt, updates, opts.OnConflict, rowId)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if opts.OnConflict == ConflictReject && len(conflicts) > 0 {
+		log.Println("The correction to the record with id: ", id, " was rejected because it conflicts with later versions.")
+		return entity.UpdateResult{ Conflicts: conflicts }, ErrUpdateConflict
+	}
+
+	// The snapshots of the corrected version and of the versions effective at the same time are stale as well.
+	if err := invalidateSnapshots(ctx, tx, id, version.UpdatedTimestamp - 1); err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if err := checkpoint(ctx, tx, id, knownAt); err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	query = "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and version_id = ? and superseded_at is null"
+	record, err := s.GetRecordDetails(ctx, tx, id, query, id, version.VersionId)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	log.Println("The version: ", version.VersionId, " of the record with id: ", id, " was corrected.")
+	return entity.UpdateResult{ Record: record, Conflicts: conflicts }, nil
+}
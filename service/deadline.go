@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The time a read or a write of the service may take before its database work is cancelled.
+const (
+	ReadTimeout  = 5 * time.Second
+	WriteTimeout = 10 * time.Second
+)
+
+// Bound the context of an operation by timeout. The returned function releases the context, and replaces the error
+// of the operation with ErrCancelled when it failed because the context was cancelled or its deadline passed.
+// A cancelled write transaction is rolled back by the database/sql package.
+// Any other error that is not a service error, such as a failed query or a corrupt version, is returned as an
+// internal error.
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, func(err *error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil && !errors.Is(*err, ErrCancelled) {
+			*err = fmt.Errorf("%w: %w", ErrCancelled, ctx.Err())
+		}
+		var serviceErr *Error
+		if *err != nil && !errors.As(*err, &serviceErr) {
+			*err = AsError(*err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// What the interrupt_write() SQL function of the sqlite3_interrupt driver calls, set by the test using it.
+var (
+	interruptMu    sync.Mutex
+	interruptWrite func()
+)
+
+func init() {
+	sql.Register("sqlite3_interrupt", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("interrupt_write", func() int {
+				interruptMu.Lock()
+				defer interruptMu.Unlock()
+
+				if interruptWrite != nil {
+					interruptWrite()
+				}
+				return 0
+			}, false)
+		},
+	})
+}
+
+// Open a service whose writes call interrupt once the version of record 2 is inserted, after record 1 is written in
+// the same transaction.
+func newInterruptedService(t *testing.T, interrupt func()) *DBRecordService {
+	t.Helper()
+
+	interruptMu.Lock()
+	interruptWrite = interrupt
+	interruptMu.Unlock()
+	t.Cleanup(func() {
+		interruptMu.Lock()
+		interruptWrite = nil
+		interruptMu.Unlock()
+	})
+
+	s, db := newTestServiceWithDriver(t, "sqlite3_interrupt")
+	tamper(t, db, `create trigger interrupt_record_2 after insert on record_versions when new.record_id = 2
+		begin select interrupt_write(); end`)
+	return s
+}
+
+// Write records 1 and 2 in one transaction, and check that it fails with ErrCancelled caused by cause and that
+// neither record was written.
+func expectInterruptedWrite(t *testing.T, ctx context.Context, s *DBRecordService, cause error) {
+	t.Helper()
+
+	writes := []RecordWrite{
+		{ ID: 1, UpdatedTimestamp: 100, Updates: set(map[string]string{ "a": "1" }) },
+		{ ID: 2, UpdatedTimestamp: 100, Updates: set(map[string]string{ "a": "1" }) },
+	}
+	_, err := s.ApplyTransaction(ctx, writes, UpdateOptions{})
+	if !errors.Is(err, ErrCancelled) || !errors.Is(err, cause) {
+		t.Fatalf("expected ErrCancelled caused by %v, got %v", cause, err)
+	}
+
+	for _, id := range []int{ 1, 2 } {
+		if _, err := s.GetRecord(context.Background(), id); !errors.Is(err, ErrRecordDoesNotExist) {
+			t.Errorf("expected record %d not to be written, got %v", id, err)
+		}
+	}
+}
+
+// A request cancelled in the middle of a write fails with ErrCancelled, and what it wrote before is rolled back.
+func TestCancelledWriteCommitsNothing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newInterruptedService(t, cancel)
+	expectInterruptedWrite(t, ctx, s, context.Canceled)
+}
+
+// A write whose deadline passes in the middle of it fails with ErrCancelled, and what it wrote before is rolled back.
+func TestExpiredWriteCommitsNothing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	s := newInterruptedService(t, func() { <-ctx.Done() })
+	expectInterruptedWrite(t, ctx, s, context.DeadlineExceeded)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// The number of versions after which the state of a record is checkpointed in record_snapshots.
+const SnapshotInterval = 10
+
+// The subset of *sql.DB and *sql.Tx used to read record data, so the same reads can run inside a write
+// transaction.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// A version of a record as stored in record_versions: the keys it set or removed, when it took effect
+// and was reported, and who wrote it.
+type versionRow struct {
+	RowId              int64
+	VersionId          int
+	UpdatedTimestamp   int64
+	ReportedTimestamp  int64
+	Changes            map[string]*string
+	Tombstone          bool
+	Provenance         entity.Provenance
+	Kind               string
+}
+
+// Apply the changes of a version to the data of a record. A nil value removes the key.
+func applyChanges(data map[string]string, changes map[string]*string) {
+	for key, value := range changes {
+		if value == nil {
+			delete(data, key)
+		} else {
+			data[key] = *value
+		}
+	}
+}
+
+// Apply a version to the data of a record. A tombstone version clears the data; the record only comes back
+// through a later version.
+func applyVersion(data map[string]string, version versionRow) {
+	if version.Tombstone {
+		for key := range data {
+			delete(data, key)
+		}
+		return
+	}
+
+	applyChanges(data, version.Changes)
+}
+
+// Read the version rows returned by a query selecting id, version_id, actual_update_timestamp, created_at,
+// changes, tombstone, actor, source, reason and kind, in that order.
+func scanVersionRows(rows *sql.Rows) ([]versionRow, error) {
+	defer rows.Close()
+
+	var versions []versionRow
+	for rows.Next() {
+		var version versionRow
+		var changesStr string
+		var actor, source, reason sql.NullString
+
+		err := rows.Scan(&version.RowId, &version.VersionId, &version.UpdatedTimestamp, &version.ReportedTimestamp, &changesStr, &version.Tombstone, &actor, &source, &reason, &version.Kind)
+		if err != nil {
+			return nil, err
+		}
+		version.Provenance = entity.Provenance{ Actor: actor.String, Source: source.String, Reason: reason.String }
+
+		version.Changes = map[string]*string{}
+		if err := json.Unmarshal([]byte(changesStr), &version.Changes); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// Rebuild the data of the record as of the current version (updatedTimestamp, versionId), starting from the
+// latest snapshot at or before that version and applying the changes of the current versions after it.
+func reconstructData(ctx context.Context, q querier, id int, updatedTimestamp int64, versionId int) (map[string]string, error) {
+
+	data := map[string]string{}
+	var fromTimestamp int64 = math.MinInt64
+	fromVersionId := 0
+
+	query := `select s.attributes, v.actual_update_timestamp, v.version_id from record_snapshots s
+		join record_versions v on v.record_id = s.record_id and v.version_id = s.version_id and v.superseded_at is null
+		where s.record_id = ? and (v.actual_update_timestamp < ? or (v.actual_update_timestamp = ? and v.version_id <= ?))
+		order by v.actual_update_timestamp desc, v.version_id desc limit 1`
+	row := q.QueryRowContext(ctx, query, id, updatedTimestamp, updatedTimestamp, versionId)
+
+	var attributesStr string
+	err := row.Scan(&attributesStr, &fromTimestamp, &fromVersionId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal([]byte(attributesStr), &data); err != nil {
+			return nil, err
+		}
+	}
+
+	query = `select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions
+		where record_id = ? and superseded_at is null
+		and (actual_update_timestamp > ? or (actual_update_timestamp = ? and version_id > ?))
+		and (actual_update_timestamp < ? or (actual_update_timestamp = ? and version_id <= ?))
+		order by actual_update_timestamp asc, version_id asc`
+	rows, err := q.QueryContext(ctx, query, id, fromTimestamp, fromTimestamp, fromVersionId, updatedTimestamp, updatedTimestamp, versionId)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		applyVersion(data, version)
+	}
+
+	return data, nil
+}
+
+// Build the record as of a version row, given the data rebuilt for it.
+func recordFromVersion(id int, version versionRow, data map[string]string) entity.Record {
+	return entity.Record{
+		ID: id,
+		Version: version.VersionId,
+		UpdatedTimestamp: version.UpdatedTimestamp,
+		ReportedTimestamp: version.ReportedTimestamp,
+		Data: data,
+		Deleted: version.Tombstone,
+		Kind: version.Kind,
+		Provenance: version.Provenance,
+	}
+}
+
+// Store an empty string as null.
+func nullString(value string) sql.NullString {
+	return sql.NullString{ String: value, Valid: value != "" }
+}
+
+// Get the revision of the record: the number of version rows written for it. record_versions is append-only, so
+// every write to the record, including a correction that restates a version, moves the revision on.
+func currentRevision(ctx context.Context, q querier, id int) (int, error) {
+	query := "select count(*) from record_versions where record_id = ?"
+	row := q.QueryRowContext(ctx, query, id)
+
+	var revision int
+	err := row.Scan(&revision)
+	return revision, err
+}
+
+// Report whether revision is one of revisions.
+func containsRevision(revisions []int, revision int) bool {
+	for _, candidate := range revisions {
+		if candidate == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// Append a new version of the record with the next stable version identifier, and return that identifier and the id
+// of its row.
+func (s *DBRecordService) appendVersion(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, knownAt int64, changes map[string]*string, tombstone bool, provenance entity.Provenance) (int, int64, error) {
+
+	changesJsonData, err := json.Marshal(changes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query := "select coalesce(max(version_id), 0) + 1 from record_versions where record_id = ?"
+	row := tx.QueryRowContext(ctx, query, id)
+
+	var versionId int
+	if err := row.Scan(&versionId); err != nil {
+		return 0, 0, err
+	}
+
+	version := newChainedVersion(id, versionId, updatedTimestamp, knownAt, changesJsonData, provenance, entity.KindChange)
+	version.Tombstone = tombstone
+
+	rowId, err := s.insertVersionRow(ctx, tx, version, sql.NullInt64{})
+	return versionId, rowId, err
+}
+
+// Discard the snapshots of the versions effective after updatedTimestamp, because a write at updatedTimestamp
+// changes the state they captured.
+func invalidateSnapshots(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64) error {
+	stmt := `delete from record_snapshots where record_id = ? and version_id in (
+		select version_id from record_versions where record_id = ? and actual_update_timestamp > ?)`
+	_, err := tx.ExecContext(ctx, stmt, id, id, updatedTimestamp)
+	return err
+}
+
+// Snapshot the latest version of the record if SnapshotInterval or more versions have been written since the
+// latest snapshot.
+func checkpoint(ctx context.Context, tx *sql.Tx, id int, createdAt int64) error {
+
+	query := `select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions
+		where record_id = ? and superseded_at is null order by actual_update_timestamp desc, version_id desc limit 1`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	latest, err := scanVersionRows(rows)
+	if err != nil || len(latest) == 0 {
+		return err
+	}
+
+	// Count the current versions after the latest snapshot.
+	query = `select count(*) from record_versions v
+		where v.record_id = ? and v.superseded_at is null
+		and not exists (
+			select 1 from record_snapshots s join record_versions sv on sv.record_id = s.record_id and sv.version_id = s.version_id and sv.superseded_at is null
+			where s.record_id = v.record_id
+			and (sv.actual_update_timestamp > v.actual_update_timestamp or (sv.actual_update_timestamp = v.actual_update_timestamp and sv.version_id >= v.version_id)))`
+	row := tx.QueryRowContext(ctx, query, id)
+
+	var sinceSnapshot int
+	if err := row.Scan(&sinceSnapshot); err != nil {
+		return err
+	}
+
+	if sinceSnapshot < SnapshotInterval {
+		return nil
+	}
+
+	data, err := reconstructData(ctx, tx, id, latest[0].UpdatedTimestamp, latest[0].VersionId)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	stmt := "insert into record_snapshots(record_id, version_id, attributes, created_at) values (?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, stmt, id, latest[0].VersionId, jsonData, createdAt)
+	return err
+}
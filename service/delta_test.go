@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Write count versions of the record, one every 100 seconds from 100 on. Each sets a key of its own and a key shared
+// with every fourth version, and every fifth removes the key of the first version.
+func writeVersions(t *testing.T, s *DBRecordService, id int, count int) {
+	t.Helper()
+
+	for i := 1; i <= count; i++ {
+		updates := set(map[string]string{
+			fmt.Sprintf("own%d", i): fmt.Sprint(i),
+			fmt.Sprintf("shared%d", i%4): fmt.Sprint(i),
+		})
+		if i%5 == 0 {
+			updates["own1"] = nil
+		}
+		write(t, s, id, int64(i*100), updates, UpdateOptions{})
+	}
+}
+
+// Count the snapshots of the record that reads can start from.
+func countSnapshots(t *testing.T, s *DBRecordService, id int) int {
+	t.Helper()
+
+	query := `select count(*) from record_snapshots s
+		join record_versions v on v.record_id = s.record_id and v.version_id = s.version_id and v.superseded_at is null
+		where s.record_id = ?`
+
+	var snapshots int
+	if err := s.db.QueryRow(query, id).Scan(&snapshots); err != nil {
+		t.Fatalf("could not count the snapshots: %v", err)
+	}
+	return snapshots
+}
+
+// Read the id of the latest snapshot of the record.
+func latestSnapshot(t *testing.T, s *DBRecordService, id int) int64 {
+	t.Helper()
+
+	var snapshotId int64
+	if err := s.db.QueryRow("select coalesce(max(id), 0) from record_snapshots where record_id = ?", id).Scan(&snapshotId); err != nil {
+		t.Fatalf("could not read the snapshots: %v", err)
+	}
+	return snapshotId
+}
+
+// Count the snapshots up to snapshotId that reads can still start from at a version effective after updatedTimestamp.
+// Those were taken before a write at updatedTimestamp and no longer hold the state of their version.
+func countStaleSnapshots(t *testing.T, s *DBRecordService, id int, snapshotId int64, updatedTimestamp int64) int {
+	t.Helper()
+
+	query := `select count(*) from record_snapshots s
+		join record_versions v on v.record_id = s.record_id and v.version_id = s.version_id and v.superseded_at is null
+		where s.record_id = ? and s.id <= ? and v.actual_update_timestamp > ?`
+
+	var snapshots int
+	if err := s.db.QueryRow(query, id, snapshotId, updatedTimestamp).Scan(&snapshots); err != nil {
+		t.Fatalf("could not count the snapshots: %v", err)
+	}
+	return snapshots
+}
+
+// Check that every version of the record, and the record itself, read from snapshots and deltas hold the same data as
+// a full replay of the versions, and that the snapshots verify.
+func expectMatchesReplay(t *testing.T, s *DBRecordService, id int) {
+	t.Helper()
+	ctx := context.Background()
+
+	versions, err := s.GetVersions(ctx, id)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	for _, replayed := range versions {
+		record, err := s.GetVersionedRecord(ctx, id, replayed.Version)
+		if err != nil {
+			t.Fatalf("could not read version %d: %v", replayed.Version, err)
+		}
+		expectData(t, fmt.Sprintf("version %d", replayed.Version), record.Data, replayed.Data)
+	}
+
+	record, err := s.GetRecord(ctx, id)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	expectData(t, "the record", record.Data, versions[len(versions)-1].Data)
+
+	verification, err := s.VerifyRecord(ctx, id)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid {
+		t.Errorf("expected the history to verify, got %+v", verification.Failures)
+	}
+}
+
+func TestReconstructMatchesReplayPastSnapshots(t *testing.T) {
+	s, _ := newTestService(t)
+
+	writeVersions(t, s, 1, 3*SnapshotInterval+3)
+
+	if snapshots := countSnapshots(t, s, 1); snapshots != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", snapshots)
+	}
+	expectMatchesReplay(t, s, 1)
+}
+
+// A back-dated write changes the state of every version after it, so the snapshots of those versions are discarded.
+func TestBackdatedWriteInvalidatesSnapshots(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	writeVersions(t, s, 1, 2*SnapshotInterval)
+	if snapshots := countSnapshots(t, s, 1); snapshots != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", snapshots)
+	}
+
+	before := latestSnapshot(t, s, 1)
+
+	write(t, s, 1, 150, set(map[string]string{ "backdated": "1" }), UpdateOptions{})
+	write(t, s, 1, 1050, set(map[string]string{ "shared0": "overwritten" }), UpdateOptions{ OnConflict: ConflictOverwrite })
+
+	if snapshots := countStaleSnapshots(t, s, 1, before, 150); snapshots != 0 {
+		t.Errorf("expected the snapshots after the back-dated writes to be discarded, got %d", snapshots)
+	}
+	expectMatchesReplay(t, s, 1)
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	if record.Data["backdated"] != "1" || record.Data["shared0"] != "overwritten" {
+		t.Errorf("expected the back-dated writes in the record, got %v", record.Data)
+	}
+}
+
+// A correction restates a version in place, so the snapshots from that version on are discarded.
+func TestCorrectionInvalidatesSnapshots(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	writeVersions(t, s, 1, 2*SnapshotInterval)
+	before := latestSnapshot(t, s, 1)
+
+	write(t, s, 1, 500, set(map[string]string{ "own5": "corrected" }), UpdateOptions{ Kind: entity.KindCorrection })
+
+	if snapshots := countStaleSnapshots(t, s, 1, before, 500); snapshots != 0 {
+		t.Errorf("expected the snapshots after the corrected version to be discarded, got %d", snapshots)
+	}
+	expectMatchesReplay(t, s, 1)
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	if record.Data["own5"] != "corrected" {
+		t.Errorf("expected the correction in the record, got %v", record.Data)
+	}
+
+	// Writing on past the interval snapshots the corrected state.
+	for i := 2*SnapshotInterval + 1; i <= 3*SnapshotInterval; i++ {
+		write(t, s, 1, int64(i*100), set(map[string]string{ "later": fmt.Sprint(i) }), UpdateOptions{})
+	}
+	if latestSnapshot(t, s, 1) == before {
+		t.Errorf("expected the record to be snapshotted again")
+	}
+	expectMatchesReplay(t, s, 1)
+}
+
+// A retraction removes a version from the history, so the snapshots of the versions after it are discarded.
+func TestRetractionInvalidatesSnapshots(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	writeVersions(t, s, 1, 2*SnapshotInterval)
+	before := latestSnapshot(t, s, 1)
+
+	versions, err := s.GetVersions(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	// The version at 300 is the only one to set own3.
+	if _, err := s.RetractVersion(ctx, 1, versions[2].Version, entity.Provenance{}); err != nil {
+		t.Fatalf("could not retract the version: %v", err)
+	}
+
+	if snapshots := countStaleSnapshots(t, s, 1, before, 300); snapshots != 0 {
+		t.Errorf("expected the snapshots after the retracted version to be discarded, got %d", snapshots)
+	}
+	expectMatchesReplay(t, s, 1)
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	if _, ok := record.Data["own3"]; ok {
+		t.Errorf("expected the retracted version to be gone from the record, got %v", record.Data)
+	}
+}
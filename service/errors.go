@@ -0,0 +1,65 @@
+package service
+
+import "errors"
+
+// The kind of a service error, which tells the caller whether the request or the service is at fault.
+type ErrorKind string
+
+const (
+	// The record or version does not exist.
+	KindNotFound ErrorKind = "not_found"
+
+	// The request conflicts with the current state of the record.
+	KindConflict ErrorKind = "conflict"
+
+	// The request is well-formed but its values are invalid.
+	KindValidation ErrorKind = "validation"
+
+	// The record has moved on since the revision the request expected.
+	KindPrecondition ErrorKind = "precondition"
+
+	// The request was cancelled or ran past its deadline.
+	KindCancelled ErrorKind = "cancelled"
+
+	// The service failed, for example because the database could not be read.
+	KindInternal ErrorKind = "internal"
+)
+
+// An error returned by the service, with its kind and a machine-readable code.
+// Err is the underlying error, if any.
+type Error struct {
+	Kind     ErrorKind
+	Code     string
+	Message  string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// A service error is the service error with the same code, so an error built with a more detailed message still
+// matches the error it details.
+func (e *Error) Is(target error) bool {
+	targetErr, ok := target.(*Error)
+	return ok && targetErr.Code == e.Code
+}
+
+// Get the service error in the chain of err. An error that is not a service error is an internal error.
+func AsError(err error) *Error {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr
+	}
+	return &Error{ Kind: KindInternal, Code: "internal", Message: "internal error", Err: err }
+}
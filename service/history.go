@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Get the history of a single attribute of the record as the intervals during which it held a value.
+// A new interval starts whenever a version sets the attribute to a different value, and an interval ends
+// when a later version changes or removes the attribute. Versions that leave the value unchanged do not
+// split an interval.
+func (s *DBRecordService) GetFieldHistory(ctx context.Context, id int, key string) (_ []entity.FieldInterval, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	versions, err := s.GetVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals := []entity.FieldInterval{}
+	var current *entity.FieldInterval
+
+	for _, version := range versions {
+		value, ok := version.Data[key]
+
+		if current != nil && ok && current.Value == value {
+			continue
+		}
+
+		if current != nil {
+			effectiveTo := version.UpdatedTimestamp
+			current.EffectiveTo = &effectiveTo
+			intervals = append(intervals, *current)
+			current = nil
+		}
+
+		if ok {
+			current = &entity.FieldInterval{
+				Key: key,
+				Value: value,
+				EffectiveFrom: version.UpdatedTimestamp,
+				Version: version.Version,
+				ReportedTimestamp: version.ReportedTimestamp,
+				Kind: version.Kind,
+			}
+		}
+	}
+
+	if current != nil {
+		intervals = append(intervals, *current)
+	}
+
+	log.Println("Found ", len(intervals), " intervals for the field: ", key, " of the record with id: ", id)
+	return intervals, nil
+}
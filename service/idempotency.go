@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Look up the result stored for the idempotency key of a write to the record. The second return value reports
+// whether the key was found. A key that was used for a different request fails with ErrIdempotencyKeyReused.
+func findIdempotentResult(ctx context.Context, q querier, id int, key string, requestHash string) (entity.UpdateResult, bool, error) {
+
+	query := "select request_hash, response from record_idempotency_keys where record_id = ? and idempotency_key = ?"
+	row := q.QueryRowContext(ctx, query, id, key)
+
+	var storedHash, response string
+	err := row.Scan(&storedHash, &response)
+	if err == sql.ErrNoRows {
+		return entity.UpdateResult{}, false, nil
+	}
+	if err != nil {
+		return entity.UpdateResult{}, false, err
+	}
+
+	if storedHash != requestHash {
+		return entity.UpdateResult{}, false, ErrIdempotencyKeyReused
+	}
+
+	var result entity.UpdateResult
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		return entity.UpdateResult{}, false, err
+	}
+
+	return result, true, nil
+}
+
+// Store the idempotency key of a write to the record with the version it wrote and its result.
+func saveIdempotentResult(ctx context.Context, tx *sql.Tx, id int, key string, requestHash string, result entity.UpdateResult, createdAt int64) error {
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	stmt := "insert into record_idempotency_keys(record_id, idempotency_key, version_id, request_hash, response, created_at) values (?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, stmt, id, key, result.Version, requestHash, response, createdAt)
+	return err
+}
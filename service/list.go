@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// List the records in the state they were in at opts.At.
+// The records of the page are selected in SQL, in id order after opts.Cursor, and only they are rebuilt. A record is
+// listed if the latest of its current versions effective at opts.At is not a tombstone, and if every key in opts.Where
+// holds the given value at opts.At. The page is read in one read-only transaction, so it is a consistent view of the
+// records even while they are being written.
+// The cursor of the next page is the id of the last record returned, and is only set when more records match.
+func (s *DBRecordService) ListRecords(ctx context.Context, opts ListOptions) (_ entity.RecordPage, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	log.Println("Listing records at: ", opts.At, " after: ", opts.Cursor, " where: ", opts.Where)
+
+	tx, err := s.readDB.BeginTx(ctx, &sql.TxOptions{ ReadOnly: true })
+	if err != nil {
+		return entity.RecordPage{}, err
+	}
+	defer tx.Rollback()
+
+	// One more record than the page holds tells whether there is a next page.
+	ids, err := matchingRecordIds(ctx, tx, opts, opts.Limit + 1)
+	if err != nil {
+		return entity.RecordPage{}, err
+	}
+
+	page := entity.RecordPage{ Records: []entity.Record{} }
+	for i, id := range ids {
+		if i == opts.Limit {
+			page.NextCursor = strconv.Itoa(ids[i-1])
+			break
+		}
+
+		record, err := s.getRecordAt(ctx, tx, id, opts.At)
+		if err != nil {
+			return entity.RecordPage{}, err
+		}
+
+		page.Records = append(page.Records, record)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.RecordPage{}, err
+	}
+
+	return page, nil
+}
+
+// Select the ids of at most limit records after opts.Cursor that exist at opts.At and match opts.Where, in id order.
+// The value of a key at opts.At is the value set by the latest current version effective by then that changed the key,
+// unless a tombstone effective after that version cleared it.
+func matchingRecordIds(ctx context.Context, q querier, opts ListOptions, limit int) ([]int, error) {
+
+	query := `select r.id from records r where r.id > ?
+		and (select v.tombstone from record_versions v
+			where v.record_id = r.id and v.superseded_at is null and v.actual_update_timestamp <= ?
+			order by v.actual_update_timestamp desc, v.version_id desc limit 1) = 0`
+	args := []interface{}{ opts.Cursor, opts.At }
+
+	keys := make([]string, 0, len(opts.Where))
+	for key := range opts.Where {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		query += `
+		and (select case when v.tombstone = 0 then (select c.value from json_each(v.changes) c where c.key = ?) end from record_versions v
+			where v.record_id = r.id and v.superseded_at is null and v.actual_update_timestamp <= ?
+			and (v.tombstone = 1 or exists (select 1 from json_each(v.changes) c where c.key = ?))
+			order by v.actual_update_timestamp desc, v.version_id desc limit 1) = ?`
+		args = append(args, key, opts.At, key, opts.Where[key])
+	}
+
+	query += " order by r.id asc limit ?"
+	args = append(args, limit)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// List the ids of the records of the page selected by opts.
+func listIds(t *testing.T, s *DBRecordService, opts ListOptions) []int {
+	t.Helper()
+
+	page, err := s.ListRecords(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("could not list the records: %v", err)
+	}
+
+	ids := []int{}
+	for _, record := range page.Records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+// Check that ids are exactly the expected ones, in order.
+func expectIds(t *testing.T, what string, ids []int, expected []int) {
+	t.Helper()
+
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("%s: expected %v, got %v", what, expected, ids)
+	}
+}
+
+// A record is listed at a time only if it exists then and is not deleted.
+func TestListExcludesDeletedRecords(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 2, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 3, 200, set(map[string]string{ "a": "1" }), UpdateOptions{})
+
+	if _, err := s.DeleteRecord(ctx, 2, 300, entity.Provenance{}); err != nil {
+		t.Fatalf("could not delete the record: %v", err)
+	}
+	if _, err := s.UndeleteRecord(ctx, 2, 500, entity.Provenance{}); err != nil {
+		t.Fatalf("could not undelete the record: %v", err)
+	}
+
+	expectIds(t, "at 150", listIds(t, s, ListOptions{ At: 150, Limit: 10 }), []int{ 1, 2 })
+	expectIds(t, "at 250", listIds(t, s, ListOptions{ At: 250, Limit: 10 }), []int{ 1, 2, 3 })
+	expectIds(t, "at 400", listIds(t, s, ListOptions{ At: 400, Limit: 10 }), []int{ 1, 3 })
+	expectIds(t, "at 600", listIds(t, s, ListOptions{ At: 600, Limit: 10 }), []int{ 1, 2, 3 })
+}
+
+// The where filter matches the value of each key at the time of the listing: the value of the latest version that
+// changed it, unless a later version removed it or a tombstone cleared it.
+func TestListWhere(t *testing.T) {
+	s, _ := newTestService(t)
+
+	write(t, s, 1, 100, set(map[string]string{ "status": "open", "kind": "auto" }), UpdateOptions{})
+	write(t, s, 2, 100, set(map[string]string{ "status": "closed", "kind": "auto" }), UpdateOptions{})
+	write(t, s, 3, 100, set(map[string]string{ "status": "open", "kind": "home" }), UpdateOptions{})
+
+	// Record 1 is closed at 200, and record 3 loses its status at 300 without being changed otherwise.
+	write(t, s, 1, 200, set(map[string]string{ "status": "closed" }), UpdateOptions{})
+	write(t, s, 3, 300, map[string]*string{ "status": nil }, UpdateOptions{})
+	write(t, s, 3, 400, set(map[string]string{ "kind": "auto" }), UpdateOptions{})
+
+	open := map[string]string{ "status": "open" }
+	expectIds(t, "open at 150", listIds(t, s, ListOptions{ At: 150, Where: open, Limit: 10 }), []int{ 1, 3 })
+	expectIds(t, "open at 250", listIds(t, s, ListOptions{ At: 250, Where: open, Limit: 10 }), []int{ 3 })
+	expectIds(t, "open at 350", listIds(t, s, ListOptions{ At: 350, Where: open, Limit: 10 }), []int{})
+
+	closedAuto := map[string]string{ "status": "closed", "kind": "auto" }
+	expectIds(t, "closed auto at 150", listIds(t, s, ListOptions{ At: 150, Where: closedAuto, Limit: 10 }), []int{ 2 })
+	expectIds(t, "closed auto at 250", listIds(t, s, ListOptions{ At: 250, Where: closedAuto, Limit: 10 }), []int{ 1, 2 })
+
+	// A value is compared as a whole, not as a prefix or pattern.
+	expectIds(t, "status open%", listIds(t, s, ListOptions{ At: 150, Where: map[string]string{ "status": "open%" }, Limit: 10 }), []int{})
+}
+
+// A tombstone clears every key, so a deleted record matches nothing even where its last value did.
+func TestListWhereAfterTombstone(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "status": "open" }), UpdateOptions{})
+	if _, err := s.DeleteRecord(ctx, 1, 200, entity.Provenance{}); err != nil {
+		t.Fatalf("could not delete the record: %v", err)
+	}
+	write(t, s, 1, 300, set(map[string]string{ "kind": "auto" }), UpdateOptions{})
+
+	open := map[string]string{ "status": "open" }
+	expectIds(t, "open at 150", listIds(t, s, ListOptions{ At: 150, Where: open, Limit: 10 }), []int{ 1 })
+	expectIds(t, "open at 350", listIds(t, s, ListOptions{ At: 350, Where: open, Limit: 10 }), []int{})
+	expectIds(t, "auto at 350", listIds(t, s, ListOptions{ At: 350, Where: map[string]string{ "kind": "auto" }, Limit: 10 }), []int{ 1 })
+}
+
+// Pages follow each other by cursor, and only a page with more records after it has a cursor.
+func TestListPagination(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	for id := 1; id <= 5; id++ {
+		status := "open"
+		if id == 3 {
+			status = "closed"
+		}
+		write(t, s, id, 100, set(map[string]string{ "status": status }), UpdateOptions{})
+	}
+
+	var listed []int
+	cursor := 0
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatalf("expected the pages to end, got %v so far", listed)
+		}
+
+		page, err := s.ListRecords(ctx, ListOptions{ At: 200, Where: map[string]string{ "status": "open" }, Limit: 2, Cursor: cursor })
+		if err != nil {
+			t.Fatalf("could not list the records: %v", err)
+		}
+		for _, record := range page.Records {
+			listed = append(listed, record.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		if len(page.Records) != 2 {
+			t.Errorf("expected a full page before the last, got %d records", len(page.Records))
+		}
+
+		cursor, err = strconv.Atoi(page.NextCursor)
+		if err != nil {
+			t.Fatalf("could not read the cursor %q: %v", page.NextCursor, err)
+		}
+	}
+	expectIds(t, "the pages", listed, []int{ 1, 2, 4, 5 })
+
+	// A page that ends exactly at the last record has no cursor.
+	page, err := s.ListRecords(ctx, ListOptions{ At: 200, Limit: 5 })
+	if err != nil {
+		t.Fatalf("could not list the records: %v", err)
+	}
+	if len(page.Records) != 5 || page.NextCursor != "" {
+		t.Errorf("expected all 5 records and no cursor, got %d records and cursor %q", len(page.Records), page.NextCursor)
+	}
+}
@@ -2,17 +2,96 @@ package service
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
+	"fmt"
 	"github.com/rainbowmga/timetravel/entity"
 	"database/sql"
 	"time"
 	"log"
+	"sort"
 	"encoding/json"
 )
 
-var ErrRecordDoesNotExist = errors.New("record with that id does not exist")
-var ErrRecordIDInvalid = errors.New("record id must >= 0")
-var ErrRecordAlreadyExists = errors.New("record already exists")
+var ErrRecordDoesNotExist = &Error{ Kind: KindNotFound, Code: "record_not_found", Message: "record with that id does not exist" }
+var ErrVersionDoesNotExist = &Error{ Kind: KindNotFound, Code: "version_not_found", Message: "the record has no version with that id" }
+var ErrRecordIDInvalid = &Error{ Kind: KindValidation, Code: "invalid_id", Message: "record id must >= 0" }
+var ErrVersionInvalid = &Error{ Kind: KindValidation, Code: "invalid_version", Message: "version must be a positive number" }
+var ErrRecordAlreadyExists = &Error{ Kind: KindConflict, Code: "record_exists", Message: "record already exists" }
+var ErrUpdateConflict = &Error{ Kind: KindConflict, Code: "update_conflict", Message: "update conflicts with later versions of the record" }
+var ErrRecordDeleted = &Error{ Kind: KindNotFound, Code: "record_deleted", Message: "the record has been deleted", Err: ErrRecordDoesNotExist }
+var ErrRecordAlreadyDeleted = &Error{ Kind: KindConflict, Code: "record_already_deleted", Message: "record is already deleted" }
+var ErrRecordNotDeleted = &Error{ Kind: KindConflict, Code: "record_not_deleted", Message: "record is not deleted" }
+var ErrDeleteBeforeLaterVersions = &Error{ Kind: KindConflict, Code: "later_versions_exist", Message: "the record has versions effective after the delete; delete it at or after its latest version" }
+var ErrPreconditionFailed = &Error{ Kind: KindPrecondition, Code: "precondition_failed", Message: "the record has been modified since the expected revision" }
+var ErrCancelled = &Error{ Kind: KindCancelled, Code: "cancelled", Message: "the request was cancelled before it completed" }
+var ErrVersionRetracted = &Error{ Kind: KindNotFound, Code: "version_retracted", Message: "the version has been retracted", Err: ErrVersionDoesNotExist }
+var ErrVersionAlreadyRetracted = &Error{ Kind: KindConflict, Code: "version_already_retracted", Message: "version is already retracted" }
+var ErrOnlyVersion = &Error{ Kind: KindConflict, Code: "only_version", Message: "the only version of a record cannot be retracted; delete the record instead" }
+var ErrWriteBeforeFirstVersion = &Error{ Kind: KindValidation, Code: "before_first_version", Message: "the write is effective before the first version of the record" }
+var ErrRevertToDeletedVersion = &Error{ Kind: KindConflict, Code: "revert_target_deleted", Message: "the target of the revert is a deleted version of the record; delete the record instead" }
+var ErrRevertUnchanged = &Error{ Kind: KindValidation, Code: "revert_unchanged", Message: "the record already holds the data of the target of the revert" }
+var ErrIdempotencyKeyReused = &Error{ Kind: KindValidation, Code: "idempotency_key_reused", Message: "the idempotency key was already used for a different request" }
+
+// How a retroactive update treats a later version that explicitly changed one of the updated keys.
+type ConflictPolicy string
+
+const (
+	// Stop propagating the key at the conflicting version and keep the later change. This is the default.
+	ConflictSkip ConflictPolicy = "skip"
+
+	// Propagate the key through the conflicting version and replace the later change.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+
+	// Reject the whole update if it conflicts with any later version.
+	ConflictReject ConflictPolicy = "reject"
+)
+
+// Options that select a page of records.
+// Records are listed in the state they were in at the effective time At, in id order starting after Cursor,
+// and only if every key in Where holds the given value.
+type ListOptions struct {
+	At      int64
+	Where   map[string]string
+	Limit   int
+	Cursor  int
+}
+
+// Options that select the records read by a batch read.
+// The records are read in the state they were in at the effective time At, as known at KnownAt. A zero KnownAt
+// reads the current knowledge.
+type BatchGetOptions struct {
+	IDs      []int
+	At       int64
+	KnownAt  int64
+}
+
+// A write to one record of a transaction. The record is created if it does not exist yet, otherwise Updates are
+// applied to it as of UpdatedTimestamp. A nil value removes the key. Kind is the kind of the write, as in
+// UpdateOptions.
+type RecordWrite struct {
+	ID                 int
+	UpdatedTimestamp   int64
+	Updates            map[string]*string
+	Kind               string
+}
+
+// Options that control how an update is applied.
+// The update is only applied if the revision of the record is one of IfMatch. A nil IfMatch applies the update
+// unconditionally and an empty IfMatch only requires the record to exist.
+// A write with an IdempotencyKey is applied once: a retry with the same key and RequestHash returns the result of
+// the first write without writing another version.
+// Provenance is stored on the versions the write appends.
+// Kind is entity.KindChange, the default, or entity.KindCorrection to correct the version in effect at the time of
+// the update instead of appending a new one.
+type UpdateOptions struct {
+	OnConflict       ConflictPolicy
+	IfMatch          []int
+	IdempotencyKey   string
+	RequestHash      string
+	Provenance       entity.Provenance
+	Kind             string
+}
 
 // Implements method to get, create, and update record data.
 type RecordService interface {
@@ -20,126 +99,296 @@ type RecordService interface {
 	// GetRecord will retrieve an record.
 	GetRecord(ctx context.Context, id int) (entity.Record, error)
 
-	// CreateRecord will insert a new record.
+	// CreateRecord will insert a new record, whose first version is written with record.Provenance.
 	//
 	// If it a record with that id already exists it will fail.
 	CreateRecord(ctx context.Context, record entity.Record) (entity.Record, error)
 
+	// WriteRecord will create the record if it does not exist, and otherwise update it like
+	// UpdateRecordWithOptions, atomically.
+	WriteRecord(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string, opts UpdateOptions) (entity.UpdateResult, error)
+
 	// UpdateRecord will change the internal `Map` values of the record if they exist.
 	// if the update[key] is null it will delete that key from the record's Map.
 	//
 	// UpdateRecord will error if id <= 0 or the record does not exist with that id.
 	UpdateRecord(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string) (entity.Record, error)
+
+	// UpdateRecordWithOptions will update the record like UpdateRecord and report the later versions the update
+	// conflicted with, resolving them according to opts.OnConflict.
+	//
+	// With ConflictReject nothing is written and ErrUpdateConflict is returned along with the conflicts.
+	UpdateRecordWithOptions(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string, opts UpdateOptions) (entity.UpdateResult, error)
 	
-	// GetVersions will get all the version of a record and it's corresponding created timestamp.
+	// RevertRecord will write a new version, effective at updatedTimestamp, whose data equals the data of target.
+	//
+	// The history of the record is left intact.
+	RevertRecord(ctx context.Context, id int, target entity.Record, updatedTimestamp int64, provenance entity.Provenance) (entity.UpdateResult, error)
+	
+	// DeleteRecord will append a tombstone version effective at updatedTimestamp, after which the record reads
+	// as not found. Reads before updatedTimestamp are unaffected.
+	//
+	// DeleteRecord will error with ErrDeleteBeforeLaterVersions if the record has versions effective after
+	// updatedTimestamp, which the tombstone would not hide.
+	DeleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (entity.Record, error)
+
+	// UndeleteRecord will append a version effective at updatedTimestamp that restores the data the record had
+	// before it was deleted.
+	//
+	// UndeleteRecord will error with ErrRecordNotDeleted if the record is not deleted at updatedTimestamp.
+	UndeleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (entity.Record, error)
+
+	// RetractVersion will retract a version of the record as of now, after which it no longer contributes to reads.
+	// Reads known before the retraction still see it.
+	RetractVersion(ctx context.Context, id int, version int, provenance entity.Provenance) (entity.Record, error)
+
+	// GetVersions will get all the version of a record and it's corresponding created timestamp, and who wrote it.
 	GetVersions(ctx context.Context, id int) ([]entity.Record, error)
 
-	// GetRecord will get a record with a specific version
+	// GetVersionedRecord will get a record by the stable identifier of one of its versions.
 	GetVersionedRecord(ctx context.Context, id int, version int) (entity.Record, error)
+
+	// VerifyRecord will check the hash chain over every row of the history of a record.
+	VerifyRecord(ctx context.Context, id int) (entity.ChainVerification, error)
+
+	// ExportRecord will get the full history of a record for an audit, with the hash chain over it.
+	ExportRecord(ctx context.Context, id int) (entity.AuditDocument, error)
+
+	// GetFieldHistory will get the intervals of effective time during which an attribute of a record held a value.
+	GetFieldHistory(ctx context.Context, id int, key string) ([]entity.FieldInterval, error)
+
+	// ListRecords will get a page of the records that exist at opts.At and match opts.Where.
+	ListRecords(ctx context.Context, opts ListOptions) (entity.RecordPage, error)
+
+	// BatchGetRecords will get the state of several records with a single consistent read.
+	BatchGetRecords(ctx context.Context, opts BatchGetOptions) (entity.RecordBatch, error)
+
+	// ApplyTransaction will apply writes to several records, either all of them or none.
+	ApplyTransaction(ctx context.Context, writes []RecordWrite, opts UpdateOptions) ([]entity.UpdateResult, error)
+
+	// GetRecordAt will get the version of a record in effect at a timestamp, including a version
+	// that took effect at exactly that timestamp.
+	GetRecordAt(ctx context.Context, id int, queryTimestamp int64) (entity.Record, error)
+
+	// GetRecordAsOf will get the state of a record effective at effectiveAt, as it was known at knownAt.
+	GetRecordAsOf(ctx context.Context, id int, effectiveAt int64, knownAt int64) (entity.Record, error)
 }
 
+// db serves the writes and readDB the reads. go-sqlite3 begins every transaction of a pool with the same lock, so the
+// reads need a pool whose transactions begin deferred instead of taking the write lock.
+// headKey signs the head of the hash chain of a record after every write. Without it heads are neither signed nor
+// verified.
 type DBRecordService struct {
 	db *sql.DB
+	readDB *sql.DB
+	headKey ed25519.PrivateKey
 }
 
-func NewDBRecordService(dbConn *sql.DB) DBRecordService {
-	return DBRecordService{	db: dbConn }
+func NewDBRecordService(dbConn *sql.DB, readConn *sql.DB, headKey ed25519.PrivateKey) DBRecordService {
+	return DBRecordService{	db: dbConn, readDB: readConn, headKey: headKey }
 }
 
 // Gets the latest version of the record.
-func (s *DBRecordService) GetRecord(ctx context.Context, id int) (entity.Record, error){
+func (s *DBRecordService) GetRecord(ctx context.Context, id int) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
 
 	log.Println("Quering the DB to retrieve record with id: ", id)
 
-	// Get the attributes of the record
-	query := "select attributes, actual_update_timestamp, created_at from record_versions where record_id = ? order by actual_update_timestamp desc limit 1"
-	
-	row := s.db.QueryRow(query, id)
+	// Get the latest version of the record
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and superseded_at is null order by actual_update_timestamp desc, version_id desc limit 1"
 	
-	return s.GetRecordDetails(id, row)
+	record, err := s.GetRecordDetails(ctx, s.readDB, id, query, id)
+	if err == nil && record.Deleted {
+		return entity.Record{}, ErrRecordDeleted
+	}
+	return record, err
 }
 
-// Gets the version of record that occurs before a timestamp.
-// This version of the record is used as a base to apply updates to the attributes.
+// Gets the version of record that is in effect at a timestamp, including a version that took effect
+// at exactly that timestamp.
+// This version of the record is also used as a base to apply updates to the attributes.
 // The updates to the attributes are based on the actual updated time not the reported time.
-func (s *DBRecordService) GetRecordAt(ctx context.Context, id int, queryTimestamp int64) (entity.Record, error){
+func (s *DBRecordService) GetRecordAt(ctx context.Context, id int, queryTimestamp int64) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
 
-	log.Println("Quering the DB to retrieve record with id: ", id)
+	log.Println("Quering the DB to retrieve record with id: ", id, " at: ", queryTimestamp)
 
-	// Get the attributes of the record
-	query := "select attributes, actual_update_timestamp, created_at from record_versions where record_id = ? and actual_update_timestamp < ? order by actual_update_timestamp desc limit 1"
+	record, err := s.getRecordAt(ctx, s.readDB, id, queryTimestamp)
+	if err == nil && record.Deleted {
+		return entity.Record{}, ErrRecordDeleted
+	}
+	return record, err
+}
+
+// Gets the version of the record in effect at a timestamp, including a tombstone version.
+func (s *DBRecordService) getRecordAt(ctx context.Context, q querier, id int, queryTimestamp int64) (entity.Record, error){
+
+	// Get the version of the record in effect at the timestamp
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and actual_update_timestamp <= ? and superseded_at is null order by actual_update_timestamp desc, version_id desc limit 1"
 	
-	row := s.db.QueryRow(query, id, queryTimestamp)
-	return s.GetRecordDetails(id, row)
+	return s.GetRecordDetails(ctx, q, id, query, id, queryTimestamp)
 }
 
-// This is the helper method that get the details of a version of the record.
-func (s *DBRecordService) GetRecordDetails(id int, row *sql.Row) (entity.Record, error){
+// Gets the bitemporal view of the record: the version effective at effectiveAt, according to what was
+// known at knownAt. A version row is known at knownAt if it was reported (created_at) at or before knownAt
+// and had not yet been superseded by then.
+// Snapshots only capture the current knowledge, so the state is rebuilt from the changes known at knownAt.
+func (s *DBRecordService) GetRecordAsOf(ctx context.Context, id int, effectiveAt int64, knownAt int64) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	log.Println("Quering the DB to retrieve record with id: ", id, " effective at: ", effectiveAt, " known at: ", knownAt)
+
+	return s.getRecordAsOf(ctx, s.readDB, id, effectiveAt, knownAt)
+}
+
+func (s *DBRecordService) getRecordAsOf(ctx context.Context, q querier, id int, effectiveAt int64, knownAt int64) (entity.Record, error){
 
-	var attributesStr string
-	var updatedTimestamp int64
-	var createdAt int64
-	err := row.Scan(&attributesStr, &updatedTimestamp, &createdAt)
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and actual_update_timestamp <= ? and created_at <= ? and (superseded_at is null or superseded_at > ?) order by actual_update_timestamp asc, version_id asc"
+
+	rows, err := q.QueryContext(ctx, query, id, effectiveAt, knownAt, knownAt)
 	if err != nil {
 		log.Println("The query failed on execution for id: ", id, " error: ", err)
+		return entity.Record{}, err
+	}
+
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		log.Println("The versions of the record with id: ", id, " could not be read. Error: ", err)
+		return entity.Record{}, err
+	}
+
+	if len(versions) == 0 {
 		return entity.Record{}, ErrRecordDoesNotExist
 	}
 
-	// Infer the version number of the record.
-	query := "select count(*) from record_versions where record_id = ? and actual_update_timestamp < ?"
+	data := map[string]string{}
+	for _, version := range versions {
+		applyVersion(data, version)
+	}
 
-	row = s.db.QueryRow(query, id, updatedTimestamp)
+	record := recordFromVersion(id, versions[len(versions)-1], data)
+	record.EffectivePosition = len(versions)
 
-	var version int
-	err = row.Scan(&version)
+	record.Revision, err = currentRevision(ctx, q, id)
 	if err != nil {
-		return entity.Record{}, ErrRecordDoesNotExist
+		return entity.Record{}, err
+	}
+
+	if record.Deleted {
+		return entity.Record{}, ErrRecordDeleted
+	}
+	return record, nil
+}
+
+// This is the helper method that get the details of a version of the record.
+// The query selects the version row, and the data of the record is rebuilt as of that version.
+func (s *DBRecordService) GetRecordDetails(ctx context.Context, q querier, id int, query string, args ...interface{}) (entity.Record, error){
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println("The query failed on execution for id: ", id, " error: ", err)
+		return entity.Record{}, err
 	}
 
-	jsonData := []byte(attributesStr)
-	attributesMap := map[string]string{}
-	err = json.Unmarshal(jsonData, &attributesMap)
+	versions, err := scanVersionRows(rows)
 	if err != nil {
-		log.Println("The JSON data failed to unmarshal. Data: ", jsonData)
+		log.Println("The version of the record with id: ", id, " could not be read. Error: ", err)
+		return entity.Record{}, err
+	}
+
+	if len(versions) == 0 {
 		return entity.Record{}, ErrRecordDoesNotExist
 	}
+	version := versions[0]
+
+	data, err := reconstructData(ctx, q, id, version.UpdatedTimestamp, version.VersionId)
+	if err != nil {
+		log.Println("The data of the record with id: ", id, " could not be rebuilt. Error: ", err)
+		return entity.Record{}, err
+	}
+
+	// Infer the effective position of the version.
+	position, err := countEarlierVersions(ctx, q, id, version.UpdatedTimestamp, version.VersionId)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	revision, err := currentRevision(ctx, q, id)
+	if err != nil {
+		return entity.Record{}, err
+	}
 
 	log.Println("The query to the DB completed successfully for the record with id: ", id)
-	record := entity.Record{ ID: id, Data: attributesMap, Version: version+1, UpdatedTimestamp: updatedTimestamp, ReportedTimestamp: createdAt}
+	record := recordFromVersion(id, version, data)
+	record.EffectivePosition = position + 1
+	record.Revision = revision
 	return record, nil
 
 }
 
+// Counts the current versions of the record that precede the version versionId in effective order.
+// Versions with the same effective timestamp are ordered by the order in which they were written.
+func countEarlierVersions(ctx context.Context, q querier, id int, updatedTimestamp int64, versionId int) (int, error) {
+
+	query := "select count(*) from record_versions where record_id = ? and (actual_update_timestamp < ? or (actual_update_timestamp = ? and version_id < ?)) and superseded_at is null"
+	row := q.QueryRowContext(ctx, query, id, updatedTimestamp, updatedTimestamp, versionId)
+
+	var position int
+	err := row.Scan(&position)
+	return position, err
+}
+
 // Create a version of the record. The created_at time stores the reported timestamp where as actual_updated_timestamp
 // stores the actual timestamp of the update.
-func (s *DBRecordService) CreateRecord(ctx context.Context, record entity.Record) (entity.Record, error) {
+func (s *DBRecordService) CreateRecord(ctx context.Context, record entity.Record) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
 	log.Println("Checking if a record with exists with id: ", record.ID)
-	
-	query := `select count(*) from records where id = ?`
-	row := s.db.QueryRow(query, record.ID)
 
-	count := 0
-	err := row.Scan(&count)
+	// The existence check and the inserts into the Record and RecordVersion tables run in one transaction, so a
+	// concurrent create of the same id cannot slip in between.
+	result, err := s.runWrite(ctx, record.ID, UpdateOptions{}, func(tx *sql.Tx, createdTimestamp int64) (entity.UpdateResult, error) {
+		exists, err := recordExists(ctx, tx, record.ID)
+		if err != nil {
+			return entity.UpdateResult{}, err
+		}
+
+		if exists {
+			log.Println("Record exists with the ID:", record.ID, " exists in the DB. Please enter a valid ID.")
+			return entity.UpdateResult{}, ErrRecordAlreadyExists
+		}
+
+		recordInDB, err := s.createRecord(ctx, tx, record, createdTimestamp)
+		return entity.UpdateResult{ Record: recordInDB }, err
+	})
 	if err != nil {
 		return entity.Record{}, err
 	}
+	
+	log.Println("Successfully added a record to the datbase with ID: ", record.ID)
+	return result.Record, nil
+}
 
-	if count != 0 {
-		log.Println("Record exists with the ID:", record.ID, " exists in the DB. Please enter a valid ID.")
-		return entity.Record{}, ErrRecordAlreadyExists
-	}
+// Report whether the records table has a row for the id.
+func recordExists(ctx context.Context, q querier, id int) (bool, error) {
+	query := `select count(*) from records where id = ?`
+	row := q.QueryRowContext(ctx, query, id)
 
-	// Insert the row into Record and RecordVersion table in a trasaction.
-	// To facilitate atomic update in both the Record and Record_Version table wrap the operations in a transaction.
-	tx, err := s.db.Begin()
-	if err != nil {
-		return entity.Record{}, ErrRecordAlreadyExists
-	}
-	defer tx.Rollback()
+	count := 0
+	err := row.Scan(&count)
+	return count != 0, err
+}
+
+// Insert the records row and the first version of a new record, known from createdTimestamp.
+func (s *DBRecordService) createRecord(ctx context.Context, tx *sql.Tx, record entity.Record, createdTimestamp int64) (entity.Record, error) {
 
 	// If the record does not exist, add a record to the db.
 	stmt := "insert into records (id, created_at) values (?, ?)"
-	_, err = tx.Exec(stmt, record.ID, time.Now().Unix())
+	_, err := tx.ExecContext(ctx, stmt, record.ID, createdTimestamp)
 	if err != nil {
 		return entity.Record{}, err
 	}
@@ -149,221 +398,602 @@ func (s *DBRecordService) CreateRecord(ctx context.Context, record entity.Record
 		return entity.Record{}, err
 	}
 
-	stmt = "insert into record_versions(attributes, actual_update_timestamp, record_id, created_at) values (?, ?, ?, ?)"
+	// The first version of a record explicitly sets every one of its keys.
+	provenance := record.Provenance
+	row := newChainedVersion(record.ID, 1, record.UpdatedTimestamp, createdTimestamp, jsonData, provenance, entity.KindChange)
 
-	createdTimestamp := time.Now().Unix()
-	_, err = tx.Exec(stmt, jsonData, record.UpdatedTimestamp, record.ID, createdTimestamp)
+	_, err = s.insertVersionRow(ctx, tx, row, sql.NullInt64{})
 	if err != nil {
 		return entity.Record{}, err
 	}
 
-	// Complete the transaction
-	tx.Commit()
-
 	recordInDB := entity.Record{
 		    ID: record.ID,
 		    Version: 1,
+		    EffectivePosition: 1,
+		    Revision: 1,
 		    UpdatedTimestamp: record.UpdatedTimestamp,
 		    ReportedTimestamp: createdTimestamp,
 		    Data: record.Data,
+		    Kind: entity.KindChange,
+		    Provenance: provenance,
 	}
-	
-	log.Println("Successfully added a record to the datbase with ID: ", record.ID)
+
 	return recordInDB, nil
 }
 
 // Update a record if the record is present.
-// The V1 of the api endpoint updates the latest version by creating a new record version at the table.
-// The V2 version of the api endpoint creates a new record_version entry. It also applies the update to all
-// record_version attributes that occur after the actual time of update.
-// This ensures that the update is applied to all versions of the record after actual time of endorsement.
+// The update is stored as a single new version holding only the changed keys. Because the state of the record
+// is rebuilt by applying the changes of its versions in effective order, a back-dated update is reflected in
+// every later version without rewriting them, and stops at the first later version that changed the same key.
+// record_versions is append-only: versions that do need restating are written as new rows and the rows they
+// replace are closed out by their superseded_at knowledge time, never edited.
 func (s *DBRecordService) UpdateRecord(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string) (entity.Record, error) {
+	result, err := s.UpdateRecordWithOptions(ctx, id, updatedTimestamp, updates, UpdateOptions{})
+	return result.Record, err
+}
+
+// Update a record and report the later versions that explicitly changed one of the updated keys.
+// The conflicts are resolved according to the ConflictPolicy in opts, which defaults to ConflictSkip.
+func (s *DBRecordService) UpdateRecordWithOptions(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string, opts UpdateOptions) (_ entity.UpdateResult, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
 	log.Println("Updating record with id: ", id, " in the database.")
 
+	result, err := s.runWrite(ctx, id, opts, func(tx *sql.Tx, knownAt int64) (entity.UpdateResult, error) {
+		return s.updateRecord(ctx, tx, id, updatedTimestamp, knownAt, updates, opts)
+	})
+	if err != nil {
+		return result, err
+	}
+	
+	log.Println("The update to the record with id: ", id, " is successfully completed.")
+	return result, nil
+}
+
+// Create the record if it does not exist, otherwise update it, in one transaction.
+// Because the existence check runs in the same transaction as the write, concurrent first writes to the same id
+// are serialized: one of them creates the record and the others update it.
+func (s *DBRecordService) WriteRecord(ctx context.Context, id int, updatedTimestamp int64, updates map[string]*string, opts UpdateOptions) (_ entity.UpdateResult, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Writing record with id: ", id, " in the database.")
+
+	result, err := s.runWrite(ctx, id, opts, func(tx *sql.Tx, knownAt int64) (entity.UpdateResult, error) {
+		return s.writeRecord(ctx, tx, id, updatedTimestamp, knownAt, updates, opts)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log.Println("The write to the record with id: ", id, " is successfully completed.")
+	return result, nil
+}
+
+// Run a write to the record in a transaction, passing it the knowledge time of the write, and commit it.
+// A write with an idempotency key that was already used returns the stored result instead of running again.
+// The write is retried while the database is busy.
+func (s *DBRecordService) runWrite(ctx context.Context, id int, opts UpdateOptions, write func(tx *sql.Tx, knownAt int64) (entity.UpdateResult, error)) (entity.UpdateResult, error) {
+
+	var result entity.UpdateResult
+	err := withBusyRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		// A retried write is answered with the result of the first one. The key is looked up before the
+		// precondition is checked, because the first write already moved the record on.
+		if opts.IdempotencyKey != "" {
+			stored, found, err := findIdempotentResult(ctx, tx, id, opts.IdempotencyKey, opts.RequestHash)
+			if err != nil {
+				return err
+			}
+
+			if found {
+				log.Println("The write to the record with id: ", id, " is a retry of the write with idempotency key: ", opts.IdempotencyKey)
+				result = stored
+				return nil
+			}
+		}
+
+		// The knowledge time of this write. Both the new version and any restated versions are
+		// recorded as known from this moment.
+		knownAt := time.Now().Unix()
+
+		result, err = write(tx, knownAt)
+		if err != nil {
+			return err
+		}
+
+		if opts.IdempotencyKey != "" {
+			if err := saveIdempotentResult(ctx, tx, id, opts.IdempotencyKey, opts.RequestHash, result, knownAt); err != nil {
+				return err
+			}
+		}
+
+		// Commit the transaction
+		return tx.Commit()
+	})
+
+	return result, err
+}
+
+// Create the record inside the transaction tx if it does not exist, otherwise update it.
+// A conditional write never creates the record.
+func (s *DBRecordService) writeRecord(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, knownAt int64, updates map[string]*string, opts UpdateOptions) (entity.UpdateResult, error) {
+
+	exists, err := recordExists(ctx, tx, id)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if exists {
+		return s.updateRecord(ctx, tx, id, updatedTimestamp, knownAt, updates, opts)
+	}
+
+	if opts.IfMatch != nil {
+		return entity.UpdateResult{}, ErrPreconditionFailed
+	}
+
+	// There is nothing to correct in a record that does not exist.
+	if opts.Kind == entity.KindCorrection {
+		return entity.UpdateResult{}, ErrRecordDoesNotExist
+	}
+
+	data := map[string]string{}
+	applyChanges(data, updates)
+
+	record := entity.Record{ ID: id, UpdatedTimestamp: updatedTimestamp, Data: data, Provenance: opts.Provenance }
+	record, err = s.createRecord(ctx, tx, record, knownAt)
+	return entity.UpdateResult{ Record: record }, err
+}
+
+// Apply an update, known from knownAt, to a record inside the transaction tx.
+func (s *DBRecordService) updateRecord(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, knownAt int64, updates map[string]*string, opts UpdateOptions) (entity.UpdateResult, error) {
+
+	if opts.Kind == entity.KindCorrection {
+		return s.correctRecord(ctx, tx, id, updatedTimestamp, knownAt, updates, opts)
+	}
+
 	// Get the record at the updatedTimestamp.
 	// For the v1 endpoints, this value from the callee is time.Now().Unix(): This ensures that all
 	// the calls chronologically ascending.
 	// For V2 endpoints, the updatedTimestamp represents the actual date of attribute update.
-	record := entity.Record{}
-	record, err := s.GetRecordAt(ctx, id, updatedTimestamp)
+	// Updating a deleted record brings it back, starting from empty data.
+	record, err := s.getRecordAt(ctx, tx, id, updatedTimestamp)
+	if err == ErrRecordDoesNotExist {
+		return entity.UpdateResult{}, beforeFirstVersionError(ctx, tx, id, updatedTimestamp)
+	}
 	if err != nil {
-		return entity.Record{}, err
+		return entity.UpdateResult{}, err
 	}
 
-	for key, value := range updates {
-		if value == nil {
-			delete(record.Data, key)
-		} else {
-			record.Data[key] = *value
-		}
+	// The revision is checked in the same transaction as the write, so no other write can land in between.
+	if len(opts.IfMatch) > 0 && !containsRevision(opts.IfMatch, record.Revision) {
+		log.Println("The update to the record with id: ", id, " was rejected because the record is at revision: ", record.Revision)
+		return entity.UpdateResult{}, ErrPreconditionFailed
 	}
 
-	jsonData, err := json.Marshal(record.Data)
+	applyChanges(record.Data, updates)
+
+	versionId, rowId, err := s.appendVersion(ctx, tx, id, updatedTimestamp, knownAt, updates, false, opts.Provenance)
 	if err != nil {
-		return entity.Record{}, err
+		return entity.UpdateResult{}, err
+	}
+
+	conflicts, err := s.ResolveLaterConflicts(ctx, tx, id, updatedTimestamp, knownAt, updates, opts.OnConflict, rowId)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if opts.OnConflict == ConflictReject && len(conflicts) > 0 {
+		log.Println("The update to the record with id: ", id, " was rejected because it conflicts with later versions.")
+		return entity.UpdateResult{ Conflicts: conflicts }, ErrUpdateConflict
+	}
+
+	if err := invalidateSnapshots(ctx, tx, id, updatedTimestamp); err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	if err := checkpoint(ctx, tx, id, knownAt); err != nil {
+		return entity.UpdateResult{}, err
 	}
 
-	tx, err := s.db.Begin()
+	position, err := countEarlierVersions(ctx, tx, id, updatedTimestamp, versionId)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	revision, err := currentRevision(ctx, tx, id)
+	if err != nil {
+		return entity.UpdateResult{}, err
+	}
+
+	record.Version = versionId
+	record.EffectivePosition = position + 1
+	record.Revision = revision
+	record.UpdatedTimestamp = updatedTimestamp
+	record.ReportedTimestamp = knownAt
+	record.Deleted = false
+	record.Kind = entity.KindChange
+	record.Provenance = opts.Provenance
+
+	return entity.UpdateResult{ Record: record.Copy(), Conflicts: conflicts }, nil
+}
+
+// Tell a write effective before the first version of an existing record, which has nothing to apply to, from a write
+// to a missing record. The error names the time the first version took effect.
+func beforeFirstVersionError(ctx context.Context, q querier, id int, updatedTimestamp int64) error {
+
+	query := "select min(actual_update_timestamp) from record_versions where record_id = ? and superseded_at is null"
+	row := q.QueryRowContext(ctx, query, id)
+
+	var first sql.NullInt64
+	if err := row.Scan(&first); err != nil {
+		return err
+	}
+	if !first.Valid {
+		return ErrRecordDoesNotExist
+	}
+
+	message := fmt.Sprintf("the write is effective at %d, before the first version of the record, which took effect at %d (%s); write at or after it",
+		updatedTimestamp, first.Int64, time.Unix(first.Int64, 0).UTC().Format(time.RFC3339))
+	return &Error{ Kind: ErrWriteBeforeFirstVersion.Kind, Code: ErrWriteBeforeFirstVersion.Code, Message: message }
+}
+
+// Revert a record to the data of an earlier version.
+// The revert is an ordinary update, effective at updatedTimestamp, that sets every key of the target that differs
+// from the record at that time and removes every key the target does not have. The record is read in the same
+// transaction as the write, so a concurrent write cannot land between the read and the update computed from it.
+// A revert to a deleted version is rejected, since it would remove every key rather than delete the record, and so
+// is a revert that would change nothing.
+func (s *DBRecordService) RevertRecord(ctx context.Context, id int, target entity.Record, updatedTimestamp int64, provenance entity.Provenance) (_ entity.UpdateResult, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Reverting record with id: ", id, " to version: ", target.Version)
+
+	if target.Deleted {
+		return entity.UpdateResult{}, ErrRevertToDeletedVersion
+	}
+
+	opts := UpdateOptions{ Provenance: provenance }
+	return s.runWrite(ctx, id, opts, func(tx *sql.Tx, knownAt int64) (entity.UpdateResult, error) {
+		record, err := s.getRecordAt(ctx, tx, id, updatedTimestamp)
+		if err != nil {
+			return entity.UpdateResult{}, err
+		}
+
+		if record.Deleted {
+			return entity.UpdateResult{}, ErrRecordDeleted
+		}
+
+		diff := record.Diff(target)
+		updates := diff.Updates()
+		if len(updates) == 0 {
+			return entity.UpdateResult{}, ErrRevertUnchanged
+		}
+
+		return s.updateRecord(ctx, tx, id, updatedTimestamp, knownAt, updates, opts)
+	})
+}
+
+// Delete a record from updatedTimestamp on by appending a tombstone version.
+// The record must exist and not already be deleted at updatedTimestamp. A tombstone only clears the data up to
+// the next version, so a delete back-dated before later versions is rejected rather than leaving the record
+// readable from those versions on, with only their own changes.
+func (s *DBRecordService) DeleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Deleting record with id: ", id, " as of: ", updatedTimestamp)
+
+	var record entity.Record
+	err = withBusyRetry(ctx, func() (err error) {
+		record, err = s.deleteRecord(ctx, id, updatedTimestamp, provenance)
+		return err
+	})
+	return record, err
+}
+
+func (s *DBRecordService) deleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (entity.Record, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return entity.Record{}, err
 	}
 	defer tx.Rollback()
 
-	stmt := "insert into record_versions(attributes, actual_update_timestamp, record_id, created_at) values (?, ?, ?, ?)"
-	_, err = tx.Exec(stmt, jsonData, updatedTimestamp, id, time.Now().Unix())
+	record, err := s.getRecordAt(ctx, tx, id, updatedTimestamp)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	if record.Deleted {
+		return entity.Record{}, ErrRecordAlreadyDeleted
+	}
 
+	later := 0
+	row := tx.QueryRowContext(ctx, "select count(*) from record_versions where record_id = ? and actual_update_timestamp > ? and superseded_at is null", id, updatedTimestamp)
+	if err := row.Scan(&later); err != nil {
+		return entity.Record{}, err
+	}
+	if later > 0 {
+		log.Println("The delete of the record with id: ", id, " was rejected because ", later, " versions are effective after it.")
+		return entity.Record{}, ErrDeleteBeforeLaterVersions
+	}
+
+	return s.writeTombstoneChange(ctx, tx, id, updatedTimestamp, map[string]*string{}, true, provenance)
+}
+
+// Undelete a record by appending a version that sets every key the record had before its tombstone.
+func (s *DBRecordService) UndeleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Undeleting record with id: ", id, " as of: ", updatedTimestamp)
+
+	var record entity.Record
+	err = withBusyRetry(ctx, func() (err error) {
+		record, err = s.undeleteRecord(ctx, id, updatedTimestamp, provenance)
+		return err
+	})
+	return record, err
+}
+
+func (s *DBRecordService) undeleteRecord(ctx context.Context, id int, updatedTimestamp int64, provenance entity.Provenance) (entity.Record, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return entity.Record{}, err
 	}
+	defer tx.Rollback()
 
-	err = s.UpdateAllRecords(tx, id, updatedTimestamp, updates)
+	tombstone, err := s.getRecordAt(ctx, tx, id, updatedTimestamp)
 	if err != nil {
 		return entity.Record{}, err
 	}
 
-	// Commit the transaction
-	tx.Commit()
-	
-	log.Println("The update to the record with id: ", id, " is successfully completed.")
-	record.UpdatedTimestamp = updatedTimestamp
+	if !tombstone.Deleted {
+		return entity.Record{}, ErrRecordNotDeleted
+	}
 
-	query := "select count(*) from record_versions where record_id = ? and actual_update_timestamp < ?"
-	row := s.db.QueryRow(query, id, updatedTimestamp)
+	// The state just before the tombstone, or empty data if the tombstone is the first version.
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and superseded_at is null and (actual_update_timestamp < ? or (actual_update_timestamp = ? and version_id < ?)) order by actual_update_timestamp desc, version_id desc limit 1"
+	previous, err := s.GetRecordDetails(ctx, tx, id, query, id, tombstone.UpdatedTimestamp, tombstone.UpdatedTimestamp, tombstone.Version)
+	if err != nil && !errors.Is(err, ErrRecordDoesNotExist) {
+		return entity.Record{}, err
+	}
 
-	var version int
-	err = row.Scan(&version)
-	
-	record.Version = version + 1
-	return record.Copy(), nil	
-}
+	changes := map[string]*string{}
+	for key, value := range previous.Data {
+		value := value
+		changes[key] = &value
+	}
 
-// Helper struct for record updates.
-type RecordUpdates struct {
-	Id       int
-	Updates  map[string]string
+	return s.writeTombstoneChange(ctx, tx, id, updatedTimestamp, changes, false, provenance)
 }
 
-// Apply the update to all the record_version after the actual time of the endorsement.
-func (s *DBRecordService) UpdateAllRecords(tx *sql.Tx, id int, updatedTimestamp int64, updates map[string]*string) error {
+// Append a version that deletes or restores a record, and commit the transaction.
+func (s *DBRecordService) writeTombstoneChange(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, changes map[string]*string, tombstone bool, provenance entity.Provenance) (entity.Record, error) {
 
-	// Get the attributes of the record
-	query := "select id, attributes from record_versions where record_id = ? and actual_update_timestamp > ?"
-	
-	rows, err := tx.Query(query, id, updatedTimestamp)
+	knownAt := time.Now().Unix()
+
+	versionId, _, err := s.appendVersion(ctx, tx, id, updatedTimestamp, knownAt, changes, tombstone, provenance)
 	if err != nil {
-		return err
+		return entity.Record{}, err
 	}
 
-	defer rows.Close()
+	if err := invalidateSnapshots(ctx, tx, id, updatedTimestamp); err != nil {
+		return entity.Record{}, err
+	}
 
+	if err := checkpoint(ctx, tx, id, knownAt); err != nil {
+		return entity.Record{}, err
+	}
 
-	var updatesToPerform []RecordUpdates
-	// Update all the records with the attribute updates that are made after the updatedTimestamp.
-	for rows.Next() {
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and version_id = ? and superseded_at is null"
+	record, err := s.GetRecordDetails(ctx, tx, id, query, id, versionId)
+	if err != nil {
+		return entity.Record{}, err
+	}
 
-		var recordVersionId int
-		var attributesStr string
-		attributes := map[string]string{}
+	if err := tx.Commit(); err != nil {
+		return entity.Record{}, err
+	}
 
-		rows.Scan(&recordVersionId, &attributesStr)
+	log.Println("The tombstone change to the record with id: ", id, " is successfully completed.")
+	return record, nil
+}
 
-		jsonData := []byte(attributesStr)
-		json.Unmarshal(jsonData, &attributes)
+// Find the later versions that explicitly changed one of the updated keys. A back-dated key only reaches
+// forward until the first later version that changed it, so each such version is reported as a conflict.
+// Conflicts are reported in effective order of the versions, and by key within a version.
+// Nothing reaches past a tombstone version.
+// With ConflictOverwrite the key keeps reaching forward instead: every later version that changed it is reported,
+// and is restated without its own change to the key so that the update wins. The restated version keeps its
+// version identifier, its kind and who wrote it; the row it replaces is closed out as of knownAt. The restated row
+// records cause, the row of the update, so that retracting the update can restore the keys it overwrote.
+func (s *DBRecordService) ResolveLaterConflicts(ctx context.Context, tx *sql.Tx, id int, updatedTimestamp int64, knownAt int64, updates map[string]*string, policy ConflictPolicy, cause int64) ([]entity.Conflict, error) {
+
+	// Get the current versions of the record that are effective after the update.
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and actual_update_timestamp > ? and superseded_at is null order by actual_update_timestamp asc, version_id asc"
+	
+	rows, err := tx.QueryContext(ctx, query, id, updatedTimestamp)
+	if err != nil {
+		return nil, err
+	}
 
-		for key, value := range updates {
+	laterVersions, err := scanVersionRows(rows)
+	if err != nil {
+		return nil, err
+	}
 
-			if value == nil {
-				delete(attributes, key)
+	// The updates that are still reaching forward.
+	pending := map[string]*string{}
+	for key, value := range updates {
+		pending[key] = value
+	}
+
+	var conflicts []entity.Conflict
+	var restatements []versionRow
+	for _, version := range laterVersions {
+		if len(pending) == 0 || version.Tombstone {
+			break
+		}
+
+		// The keys are visited in order, so the conflicts of a version are reported in the same order every time.
+		keys := make([]string, 0, len(version.Changes))
+		for key := range version.Changes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		restated := false
+		for _, key := range keys {
+			laterValue := version.Changes[key]
+			retroactiveValue, ok := pending[key]
+			if !ok {
+				continue
+			}
+
+			conflict := entity.Conflict{ Version: version.VersionId, UpdatedTimestamp: version.UpdatedTimestamp, Key: key, RetroactiveValue: retroactiveValue, LaterValue: laterValue }
+			conflicts = append(conflicts, conflict)
+
+			if policy == ConflictOverwrite {
+				delete(version.Changes, key)
+				restated = true
 			} else {
-				attributes[key] = *value
+				delete(pending, key)
 			}
 		}
 
-		updatedRecord := RecordUpdates { Id: recordVersionId, Updates: attributes }
-		updatesToPerform = append(updatesToPerform, updatedRecord)
+		if restated {
+			restatements = append(restatements, version)
+		}
 	}
 
+	if policy == ConflictReject && len(conflicts) > 0 {
+		return conflicts, nil
+	}
 
-	stmt := "update record_versions set attributes = ? where id = ?"
-	for _, updatedRecord := range updatesToPerform {
+	closeStmt := "update record_versions set superseded_at = ? where id = ? and superseded_at is null"
+	for _, restatement := range restatements {
 
-		updatedJsonData, err := json.Marshal(updatedRecord.Updates)
+		restatedChangesJsonData, err := json.Marshal(restatement.Changes)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		_, err = tx.Exec(stmt, updatedJsonData, updatedRecord.Id)
+		_, err = tx.ExecContext(ctx, closeStmt, knownAt, restatement.RowId)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		row := newChainedVersion(id, restatement.VersionId, restatement.UpdatedTimestamp, knownAt, restatedChangesJsonData, restatement.Provenance, restatement.Kind)
+		row.Supersedes = &restatement.RowId
+		row.RestatedBy = &cause
+
+		_, err = s.insertVersionRow(ctx, tx, row, sql.NullInt64{})
+		if err != nil {
+			return nil, err
 		}
-		
 	}
 	
-	return nil
+	return conflicts, nil
 }
 
 // Get all the versions of the record.
-func (s *DBRecordService) GetVersions(ctx context.Context, id int) ([]entity.Record, error) {
+// The data of each version is rebuilt by applying the changes of the versions in effective order.
+func (s *DBRecordService) GetVersions(ctx context.Context, id int) (_ []entity.Record, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
+
+	return getVersions(ctx, s.readDB, id)
+}
+
+func getVersions(ctx context.Context, q querier, id int) ([]entity.Record, error) {
 
 	var records []entity.Record
 
-	_, err := s.GetRecord(ctx, id)
-	if err != nil {
-		log.Println("The record with id: ", id, " could not be found.")
-		return records, err
-	}
-	
-	query := "select attributes, actual_update_timestamp, created_at from record_versions where record_id = ? order by actual_update_timestamp asc"
-	rows, err := s.db.Query(query, id)
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and superseded_at is null order by actual_update_timestamp asc, version_id asc"
+	rows, err := q.QueryContext(ctx, query, id)
 	if err != nil {
 		log.Println("There was an error when quering the versions. Error: ", err)
 		return records, err 
 	}
 
-	defer rows.Close()
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		log.Println("There was an error when reading the versions. Error: ", err)
+		return records, err
+	}
+
+	if len(versions) == 0 {
+		log.Println("The record with id: ", id, " could not be found.")
+		return records, ErrRecordDoesNotExist
+	}
 
-	version := 1
-	for rows.Next() {
-		var record entity.Record
-		var attributesStr string
-		
-		rows.Scan(&attributesStr, &record.UpdatedTimestamp, &record.ReportedTimestamp)
+	revision, err := currentRevision(ctx, q, id)
+	if err != nil {
+		return records, err
+	}
 
-		jsonData := []byte(attributesStr)
-		json.Unmarshal(jsonData, &record.Data)
+	data := map[string]string{}
+	for position, version := range versions {
+		applyVersion(data, version)
 
-		record.ID = id
-		
-		record.Version = version
-		version = version + 1
-		
-		records = append(records, record)
+		record := recordFromVersion(id, version, data)
+		record.EffectivePosition = position + 1
+		record.Revision = revision
+		records = append(records, record.Copy())
 	}
 
 	return records, nil
 }
 
-// Get a specific version of the record.
-func (s *DBRecordService) GetVersionedRecord(ctx context.Context, id int, version int) (entity.Record, error) {
+// Get a specific version of the record by its stable version identifier.
+func (s *DBRecordService) GetVersionedRecord(ctx context.Context, id int, version int) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, ReadTimeout)
+	defer done(&err)
 
-	var record entity.Record
+	if version <= 0 {
+		return entity.Record{}, ErrVersionInvalid
+	}
 
-	query := "select attributes, actual_update_timestamp, created_at from record_versions where record_id = ? order by actual_update_timestamp asc limit 1 offset ?"
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and version_id = ? and superseded_at is null"
 
-	row := s.db.QueryRow(query, id, version-1)
-		
-	var attributesStr string
-	err := row.Scan(&attributesStr, &record.UpdatedTimestamp, &record.ReportedTimestamp)
-	if err != nil {
+	record, err := s.GetRecordDetails(ctx, s.readDB, id, query, id, version)
+	if !errors.Is(err, ErrRecordDoesNotExist) {
 		return record, err
 	}
 
-	jsonData :=[]byte(attributesStr)
-	json.Unmarshal(jsonData, &record.Data)
+	return entity.Record{}, missingVersionError(ctx, s.readDB, id, version)
+}
 
-	record.ID = id
-	
-	record.Version = version
+// Tell a retracted version and a missing version of an existing record apart from a missing record.
+func missingVersionError(ctx context.Context, q querier, id int, version int) error {
+	exists, err := recordExists(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordDoesNotExist
+	}
 
-	return record, nil
+	query := "select count(*) from record_versions where record_id = ? and version_id = ? and retracted = 1"
+	row := q.QueryRowContext(ctx, query, id, version)
+
+	retracted := 0
+	if err := row.Scan(&retracted); err != nil {
+		return err
+	}
+	if retracted != 0 {
+		return ErrVersionRetracted
+	}
+	return ErrVersionDoesNotExist
 }
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/rainbowmga/timetravel/entity"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open a migrated database in a temporary directory and a service over it.
+func newTestService(t *testing.T) (*DBRecordService, *sql.DB) {
+	t.Helper()
+
+	return newTestServiceWithDriver(t, "sqlite3")
+}
+
+// Like newTestService, with the writes going through the named database/sql driver.
+func newTestServiceWithDriver(t *testing.T, driver string) (*DBRecordService, *sql.DB) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "insurance_data.db")
+	db, err := sql.Open(driver, path+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	goose.SetBaseFS(os.DirFS(".."))
+	goose.SetLogger(goose.NopLogger())
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		t.Fatalf("could not select the dialect: %v", err)
+	}
+	if err := goose.Up(db, "migrations"); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	readDB, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_txlock=deferred&_query_only=true")
+	if err != nil {
+		t.Fatalf("could not open the database for reads: %v", err)
+	}
+	t.Cleanup(func() { readDB.Close() })
+
+	_, headKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("could not generate the head key: %v", err)
+	}
+
+	service := NewDBRecordService(db, readDB, headKey)
+	return &service, db
+}
+
+// Write updates to the record as of updatedTimestamp, creating it if it does not exist.
+func write(t *testing.T, s *DBRecordService, id int, updatedTimestamp int64, updates map[string]*string, opts UpdateOptions) entity.UpdateResult {
+	t.Helper()
+
+	result, err := s.WriteRecord(context.Background(), id, updatedTimestamp, updates, opts)
+	if err != nil {
+		t.Fatalf("could not write the record at %d: %v", updatedTimestamp, err)
+	}
+	return result
+}
+
+// Build the updates that set the keys of values.
+func set(values map[string]string) map[string]*string {
+	updates := map[string]*string{}
+	for key, value := range values {
+		value := value
+		updates[key] = &value
+	}
+	return updates
+}
+
+// Check that data holds exactly the keys and values of expected.
+func expectData(t *testing.T, what string, data map[string]string, expected map[string]string) {
+	t.Helper()
+
+	if len(data) != len(expected) {
+		t.Errorf("%s: expected %v, got %v", what, expected, data)
+		return
+	}
+	for key, value := range expected {
+		if actual, ok := data[key]; !ok || actual != value {
+			t.Errorf("%s: expected %v, got %v", what, expected, data)
+			return
+		}
+	}
+}
+
+// A tombstone only clears the data up to the next version, so a delete back-dated before a later version is
+// rejected, and the record keeps reading as it did.
+func TestDeleteBeforeLaterVersion(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1", "b": "2" }), UpdateOptions{})
+	write(t, s, 1, 300, set(map[string]string{ "a": "3" }), UpdateOptions{})
+
+	_, err := s.DeleteRecord(ctx, 1, 200, entity.Provenance{})
+	if !errors.Is(err, ErrDeleteBeforeLaterVersions) {
+		t.Fatalf("expected ErrDeleteBeforeLaterVersions, got %v", err)
+	}
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	expectData(t, "the record after the rejected delete", record.Data, map[string]string{ "a": "3", "b": "2" })
+
+	// A delete at or after the latest version is applied, and reads from it on return not found.
+	if _, err := s.DeleteRecord(ctx, 1, 300, entity.Provenance{}); err != nil {
+		t.Fatalf("could not delete the record: %v", err)
+	}
+
+	if _, err := s.GetRecord(ctx, 1); !errors.Is(err, ErrRecordDeleted) {
+		t.Errorf("expected the record to be deleted, got %v", err)
+	}
+
+	if _, err := s.GetRecordAt(ctx, 1, 400); !errors.Is(err, ErrRecordDeleted) {
+		t.Errorf("expected the record to be deleted at 400, got %v", err)
+	}
+
+	record, err = s.GetRecordAt(ctx, 1, 299)
+	if err != nil {
+		t.Fatalf("could not read the record before the delete: %v", err)
+	}
+	expectData(t, "the record before the delete", record.Data, map[string]string{ "a": "1", "b": "2" })
+}
+
+// A revert to a deleted version would remove every key instead of deleting the record, so it is rejected.
+func TestRevertToDeletedVersion(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	if _, err := s.DeleteRecord(ctx, 1, 200, entity.Provenance{}); err != nil {
+		t.Fatalf("could not delete the record: %v", err)
+	}
+	if _, err := s.UndeleteRecord(ctx, 1, 300, entity.Provenance{}); err != nil {
+		t.Fatalf("could not undelete the record: %v", err)
+	}
+
+	versions, err := s.GetVersions(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	tombstone, err := s.GetVersionedRecord(ctx, 1, versions[1].Version)
+	if err != nil {
+		t.Fatalf("could not read the deleted version: %v", err)
+	}
+	if !tombstone.Deleted {
+		t.Fatalf("expected version %d to be deleted", tombstone.Version)
+	}
+
+	if _, err := s.RevertRecord(ctx, 1, tombstone, 400, entity.Provenance{}); !errors.Is(err, ErrRevertToDeletedVersion) {
+		t.Fatalf("expected ErrRevertToDeletedVersion, got %v", err)
+	}
+
+	after, err := s.GetVersions(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+	if len(after) != len(versions) {
+		t.Errorf("expected no version to be written, got %d versions instead of %d", len(after), len(versions))
+	}
+}
+
+// A revert to a version holding the data the record holds already would append an empty version, so it is rejected.
+func TestRevertToUnchangedVersion(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	first := write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 1, 200, set(map[string]string{ "a": "2" }), UpdateOptions{})
+	write(t, s, 1, 300, set(map[string]string{ "a": "1" }), UpdateOptions{})
+
+	target, err := s.GetVersionedRecord(ctx, 1, first.Version)
+	if err != nil {
+		t.Fatalf("could not read the target: %v", err)
+	}
+
+	if _, err := s.RevertRecord(ctx, 1, target, 400, entity.Provenance{}); !errors.Is(err, ErrRevertUnchanged) {
+		t.Fatalf("expected ErrRevertUnchanged, got %v", err)
+	}
+
+	versions, err := s.GetVersions(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Errorf("expected no version to be written, got %d versions", len(versions))
+	}
+
+	// A revert that changes the record is applied.
+	result, err := s.RevertRecord(ctx, 1, versions[1], 400, entity.Provenance{})
+	if err != nil {
+		t.Fatalf("could not revert the record: %v", err)
+	}
+	expectData(t, "the reverted record", result.Record.Data, map[string]string{ "a": "2" })
+}
+
+// A write effective before the first version of an existing record has nothing to apply to. It is rejected with the
+// time of the first version rather than reported as a missing record.
+func TestWriteBeforeFirstVersion(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 1000, set(map[string]string{ "a": "1" }), UpdateOptions{})
+
+	for _, kind := range []string{ entity.KindChange, entity.KindCorrection } {
+		_, err := s.WriteRecord(ctx, 1, 500, set(map[string]string{ "a": "0" }), UpdateOptions{ Kind: kind })
+		if !errors.Is(err, ErrWriteBeforeFirstVersion) {
+			t.Fatalf("%s: expected ErrWriteBeforeFirstVersion, got %v", kind, err)
+		}
+		if !strings.Contains(err.Error(), "took effect at 1000") {
+			t.Errorf("%s: expected the error to name the first version, got %v", kind, err)
+		}
+	}
+
+	if _, err := s.UpdateRecord(ctx, 2, 500, set(map[string]string{ "a": "0" })); !errors.Is(err, ErrRecordDoesNotExist) {
+		t.Errorf("expected a missing record to be reported as missing, got %v", err)
+	}
+}
+
+// Version identifiers are stable: a back-dated version gets the next identifier and only moves the effective
+// positions of the versions after it, so a stored reference to a version keeps pointing at the same data.
+func TestBackdatedVersionKeepsVersionIdentifiers(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	first := write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	second := write(t, s, 1, 300, set(map[string]string{ "b": "3" }), UpdateOptions{})
+
+	before, err := s.GetVersionedRecord(ctx, 1, second.Version)
+	if err != nil {
+		t.Fatalf("could not read version %d: %v", second.Version, err)
+	}
+
+	backdated := write(t, s, 1, 200, set(map[string]string{ "c": "2" }), UpdateOptions{})
+	if backdated.Version <= second.Version || backdated.EffectivePosition != 2 {
+		t.Errorf("expected the back-dated version to get a new identifier at position 2, got version %d at position %d", backdated.Version, backdated.EffectivePosition)
+	}
+
+	versions, err := s.GetVersions(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+
+	expected := []int{ first.Version, backdated.Version, second.Version }
+	for position, version := range versions {
+		if version.Version != expected[position] || version.EffectivePosition != position+1 {
+			t.Errorf("expected version %d at position %d, got version %d at position %d", expected[position], position+1, version.Version, version.EffectivePosition)
+		}
+	}
+
+	after, err := s.GetVersionedRecord(ctx, 1, second.Version)
+	if err != nil {
+		t.Fatalf("could not read version %d: %v", second.Version, err)
+	}
+	if after.UpdatedTimestamp != before.UpdatedTimestamp || after.EffectivePosition != before.EffectivePosition+1 {
+		t.Errorf("expected version %d to stay at 300 and move to position %d, got %d at position %d", second.Version, before.EffectivePosition+1, after.UpdatedTimestamp, after.EffectivePosition)
+	}
+	expectData(t, "the later version", after.Data, map[string]string{ "a": "1", "b": "3", "c": "2" })
+}
+
+// A read at a timestamp includes the versions that took effect at exactly that timestamp, and of two versions at the
+// same timestamp, the later one.
+func TestReadAtSameTimestampAsUpdate(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 1, 100, set(map[string]string{ "a": "2", "b": "2" }), UpdateOptions{})
+
+	record, err := s.GetRecordAt(ctx, 1, 100)
+	if err != nil {
+		t.Fatalf("could not read the record at 100: %v", err)
+	}
+	expectData(t, "the record at 100", record.Data, map[string]string{ "a": "2", "b": "2" })
+
+	if _, err := s.GetRecordAt(ctx, 1, 99); !errors.Is(err, ErrRecordDoesNotExist) {
+		t.Errorf("expected the record not to exist at 99, got %v", err)
+	}
+}
+
+// A read as of knownAt sees the versions reported by then, and the versions a later back-dated update restated as
+// they were before it.
+func TestReadAsOfKnownAt(t *testing.T) {
+	s, db := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 1, 300, set(map[string]string{ "a": "3" }), UpdateOptions{})
+
+	// Report the versions at 1000 and 2000, long before the back-dated update.
+	tamper(t, db, "update record_versions set created_at = 1000 where record_id = ? and actual_update_timestamp = 100", 1)
+	tamper(t, db, "update record_versions set created_at = 2000 where record_id = ? and actual_update_timestamp = 300", 1)
+
+	write(t, s, 1, 200, set(map[string]string{ "a": "x", "b": "x" }), UpdateOptions{ OnConflict: ConflictOverwrite })
+
+	for _, read := range []struct {
+		EffectiveAt   int64
+		KnownAt       int64
+		Expected      map[string]string
+	}{
+		{ 400, 1000, map[string]string{ "a": "1" } },
+		{ 400, 2000, map[string]string{ "a": "3" } },
+		{ 250, 2000, map[string]string{ "a": "1" } },
+		{ 400, time.Now().Unix(), map[string]string{ "a": "x", "b": "x" } },
+		{ 250, time.Now().Unix(), map[string]string{ "a": "x", "b": "x" } },
+	} {
+		record, err := s.GetRecordAsOf(ctx, 1, read.EffectiveAt, read.KnownAt)
+		if err != nil {
+			t.Fatalf("could not read the record at %d as of %d: %v", read.EffectiveAt, read.KnownAt, err)
+		}
+		expectData(t, fmt.Sprintf("the record at %d as of %d", read.EffectiveAt, read.KnownAt), record.Data, read.Expected)
+	}
+
+	if _, err := s.GetRecordAsOf(ctx, 1, 400, 999); !errors.Is(err, ErrRecordDoesNotExist) {
+		t.Errorf("expected the record not to be known at 999, got %v", err)
+	}
+}
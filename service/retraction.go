@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Retract a version of the record as of now. The current row of the version is closed out and a retraction row
+// supersedes it, so the version no longer contributes to the record while reads known before the retraction still
+// see it. The retraction row records who retracted the version and why, and is closed out as soon as it is written
+// so that it is never read as a version itself.
+// The keys that the retracted version overwrote in later versions, when it was written or corrected with
+// ConflictOverwrite, are restored to those versions.
+func (s *DBRecordService) RetractVersion(ctx context.Context, id int, version int, provenance entity.Provenance) (_ entity.Record, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Retracting version: ", version, " of the record with id: ", id)
+
+	if version <= 0 {
+		return entity.Record{}, ErrVersionInvalid
+	}
+
+	var record entity.Record
+	err = withBusyRetry(ctx, func() (err error) {
+		record, err = s.retractVersion(ctx, id, version, provenance)
+		return err
+	})
+	return record, err
+}
+
+func (s *DBRecordService) retractVersion(ctx context.Context, id int, version int, provenance entity.Provenance) (entity.Record, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	defer tx.Rollback()
+
+	query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and version_id = ? and superseded_at is null"
+	rows, err := tx.QueryContext(ctx, query, id, version)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	versions, err := scanVersionRows(rows)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	if len(versions) == 0 {
+		err := missingVersionError(ctx, tx, id, version)
+		if errors.Is(err, ErrVersionRetracted) {
+			return entity.Record{}, ErrVersionAlreadyRetracted
+		}
+		return entity.Record{}, err
+	}
+	retracted := versions[0]
+
+	// The version as it was before the retraction.
+	record, err := s.GetRecordDetails(ctx, tx, id, query, id, version)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	// A record keeps at least one version.
+	count := 0
+	row := tx.QueryRowContext(ctx, "select count(*) from record_versions where record_id = ? and superseded_at is null", id)
+	if err := row.Scan(&count); err != nil {
+		return entity.Record{}, err
+	}
+	if count == 1 {
+		return entity.Record{}, ErrOnlyVersion
+	}
+
+	knownAt := time.Now().Unix()
+
+	closeStmt := "update record_versions set superseded_at = ? where id = ? and superseded_at is null"
+	_, err = tx.ExecContext(ctx, closeStmt, knownAt, retracted.RowId)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	retraction := newChainedVersion(id, retracted.VersionId, retracted.UpdatedTimestamp, knownAt, []byte("{}"), provenance, retracted.Kind)
+	retraction.Supersedes = &retracted.RowId
+	retraction.Tombstone = retracted.Tombstone
+	retraction.Retracted = true
+
+	retractionRowId, err := s.insertVersionRow(ctx, tx, retraction, sql.NullInt64{ Int64: knownAt, Valid: true })
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	if err := s.restoreOverwrittenKeys(ctx, tx, id, retracted.VersionId, retractionRowId, knownAt); err != nil {
+		return entity.Record{}, err
+	}
+
+	// The snapshots of the retracted version and of the versions effective at the same time or later are stale.
+	if err := invalidateSnapshots(ctx, tx, id, retracted.UpdatedTimestamp - 1); err != nil {
+		return entity.Record{}, err
+	}
+
+	if err := checkpoint(ctx, tx, id, knownAt); err != nil {
+		return entity.Record{}, err
+	}
+
+	revision, err := currentRevision(ctx, tx, id)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.Record{}, err
+	}
+
+	log.Println("The version: ", version, " of the record with id: ", id, " is successfully retracted.")
+
+	record.Retracted = true
+	record.Revision = revision
+	return record, nil
+}
+
+// Restore the keys that the rows of a retracted version overwrote in later versions. Every later version restated by
+// one of those rows gets back the keys the restatement removed, on top of its current row, unless the key was set on
+// the version again since. The version is restated once more, by the retraction row, and the row it replaces is
+// closed out as of knownAt. A later version that has been retracted itself is left alone.
+func (s *DBRecordService) restoreOverwrittenKeys(ctx context.Context, tx *sql.Tx, id int, version int, retraction int64, knownAt int64) error {
+
+	query := `select r.version_id, r.changes, s.changes from record_versions r join record_versions s on s.id = r.supersedes
+		where r.record_id = ? and r.restated_by in (select id from record_versions where record_id = ? and version_id = ?)
+		order by r.id asc`
+	rows, err := tx.QueryContext(ctx, query, id, id, version)
+	if err != nil {
+		return err
+	}
+
+	// The keys each version lost to the retracted version, with the values they had before, in the order in which
+	// the versions were first restated.
+	removed := map[int]map[string]*string{}
+	var restatedVersions []int
+	for rows.Next() {
+		var restatedVersion int
+		var restatedStr, supersededStr string
+		if err := rows.Scan(&restatedVersion, &restatedStr, &supersededStr); err != nil {
+			rows.Close()
+			return err
+		}
+
+		restated, superseded := map[string]*string{}, map[string]*string{}
+		if err := json.Unmarshal([]byte(restatedStr), &restated); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal([]byte(supersededStr), &superseded); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if _, ok := removed[restatedVersion]; !ok {
+			removed[restatedVersion] = map[string]*string{}
+			restatedVersions = append(restatedVersions, restatedVersion)
+		}
+		for key, value := range superseded {
+			if _, ok := restated[key]; ok {
+				continue
+			}
+			if _, ok := removed[restatedVersion][key]; !ok {
+				removed[restatedVersion][key] = value
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	closeStmt := "update record_versions set superseded_at = ? where id = ? and superseded_at is null"
+	for _, restatedVersion := range restatedVersions {
+
+		query := "select id, version_id, actual_update_timestamp, created_at, changes, tombstone, actor, source, reason, kind from record_versions where record_id = ? and version_id = ? and superseded_at is null"
+		rows, err := tx.QueryContext(ctx, query, id, restatedVersion)
+		if err != nil {
+			return err
+		}
+
+		current, err := scanVersionRows(rows)
+		if err != nil {
+			return err
+		}
+		if len(current) == 0 {
+			continue
+		}
+		restoration := current[0]
+
+		restored := false
+		for key, value := range removed[restatedVersion] {
+			if _, ok := restoration.Changes[key]; !ok {
+				restoration.Changes[key] = value
+				restored = true
+			}
+		}
+		if !restored {
+			continue
+		}
+
+		changesJsonData, err := json.Marshal(restoration.Changes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, closeStmt, knownAt, restoration.RowId)
+		if err != nil {
+			return err
+		}
+
+		row := newChainedVersion(id, restoration.VersionId, restoration.UpdatedTimestamp, knownAt, changesJsonData, restoration.Provenance, restoration.Kind)
+		row.Supersedes = &restoration.RowId
+		row.RestatedBy = &retraction
+
+		if _, err := s.insertVersionRow(ctx, tx, row, sql.NullInt64{}); err != nil {
+			return err
+		}
+
+		log.Println("Restored the keys that the retracted version: ", version, " overwrote in version: ", restatedVersion, " of the record with id: ", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Retracting a back-dated write that overwrote a later change brings the later change back.
+func TestRetractRestoresOverwrittenKeys(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1", "b": "1" }), UpdateOptions{})
+	write(t, s, 1, 300, set(map[string]string{ "a": "3", "b": "3" }), UpdateOptions{})
+	mistake := write(t, s, 1, 200, set(map[string]string{ "a": "oops" }), UpdateOptions{ OnConflict: ConflictOverwrite })
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	expectData(t, "the record after the overwrite", record.Data, map[string]string{ "a": "oops", "b": "3" })
+
+	// The time a read must be known at to see the state before the retraction.
+	beforeRetraction := time.Now().Unix()
+	time.Sleep(time.Until(time.Unix(beforeRetraction+1, 0)))
+
+	if _, err := s.RetractVersion(ctx, 1, mistake.Version, entity.Provenance{ Reason: "fat-fingered" }); err != nil {
+		t.Fatalf("could not retract the version: %v", err)
+	}
+
+	record, err = s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	expectData(t, "the record after the retraction", record.Data, map[string]string{ "a": "3", "b": "3" })
+
+	record, err = s.GetRecordAt(ctx, 1, 250)
+	if err != nil {
+		t.Fatalf("could not read the record at 250: %v", err)
+	}
+	expectData(t, "the record at 250 after the retraction", record.Data, map[string]string{ "a": "1", "b": "1" })
+
+	// Reads known before the retraction still see the overwrite.
+	record, err = s.GetRecordAsOf(ctx, 1, 300, beforeRetraction)
+	if err != nil {
+		t.Fatalf("could not read the record known before the retraction: %v", err)
+	}
+	expectData(t, "the record known before the retraction", record.Data, map[string]string{ "a": "oops", "b": "3" })
+
+	verification, err := s.VerifyRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid {
+		t.Errorf("expected the history to verify, got %+v", verification.Failures)
+	}
+}
+
+// A key set on the overwritten version again after the overwrite is not replaced by the value the overwrite removed.
+func TestRetractKeepsKeysSetSinceTheOverwrite(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 1, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+	write(t, s, 1, 300, set(map[string]string{ "a": "3" }), UpdateOptions{})
+	mistake := write(t, s, 1, 200, set(map[string]string{ "a": "oops" }), UpdateOptions{ OnConflict: ConflictOverwrite })
+	write(t, s, 1, 300, set(map[string]string{ "a": "fixed" }), UpdateOptions{ Kind: entity.KindCorrection })
+
+	if _, err := s.RetractVersion(ctx, 1, mistake.Version, entity.Provenance{}); err != nil {
+		t.Fatalf("could not retract the version: %v", err)
+	}
+
+	record, err := s.GetRecord(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not read the record: %v", err)
+	}
+	expectData(t, "the record after the retraction", record.Data, map[string]string{ "a": "fixed" })
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The number of times a write is retried while SQLite reports the database busy, and the delay before the
+// first retry, which doubles with every retry.
+const (
+	maxBusyRetries   = 5
+	busyRetryBackoff = 20 * time.Millisecond
+)
+
+// Report whether the error is SQLite reporting that another connection holds the lock on the database.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// Run a write transaction, and run it again with a backoff while it fails because the database is busy.
+// The connection already waits on a busy database for its busy timeout; this covers writers that waited longer.
+func withBusyRetry(ctx context.Context, write func() error) error {
+	backoff := busyRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if !isBusy(err) || attempt == maxBusyRetries {
+			return err
+		}
+
+		log.Println("The database is busy, retrying the write in ", backoff, ". Attempt: ", attempt+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// Apply writes to several records in one transaction: either every write is committed or none is.
+// All the versions written by the transaction are known from the same moment. The conflicts of each update are
+// resolved according to opts.
+// If a write fails, the error names the write, and the returned results end with the result of the failing write,
+// which holds its conflicts when the transaction was rejected with ErrUpdateConflict.
+func (s *DBRecordService) ApplyTransaction(ctx context.Context, writes []RecordWrite, opts UpdateOptions) (_ []entity.UpdateResult, err error) {
+	ctx, done := withDeadline(ctx, WriteTimeout)
+	defer done(&err)
+
+	log.Println("Applying a transaction of ", len(writes), " writes.")
+
+	var results []entity.UpdateResult
+	err = withBusyRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		knownAt := time.Now().Unix()
+		results = []entity.UpdateResult{}
+
+		for i, write := range writes {
+			writeOpts := opts
+			writeOpts.Kind = write.Kind
+
+			result, err := s.writeRecord(ctx, tx, write.ID, write.UpdatedTimestamp, knownAt, write.Updates, writeOpts)
+
+			results = append(results, result)
+			if err != nil {
+				log.Println("The transaction was rolled back because write ", i, " to the record with id: ", write.ID, " failed.")
+				return fmt.Errorf("write %d to record %d: %w", i, write.ID, err)
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return results, err
+	}
+
+	log.Println("The transaction of ", len(writes), " writes is successfully committed.")
+	return results, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rainbowmga/timetravel/entity"
+)
+
+// A write that fails in the middle of a transaction rolls back the writes before it, and the writes after it are not
+// applied.
+func TestTransactionRollsBackOnFailingWrite(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	write(t, s, 2, 100, set(map[string]string{ "a": "1" }), UpdateOptions{})
+
+	writes := []RecordWrite{
+		{ ID: 1, UpdatedTimestamp: 100, Updates: set(map[string]string{ "a": "new" }) },
+		{ ID: 2, UpdatedTimestamp: 200, Updates: set(map[string]string{ "a": "2" }) },
+		// There is nothing to correct in a record that does not exist.
+		{ ID: 3, UpdatedTimestamp: 100, Updates: set(map[string]string{ "a": "1" }), Kind: entity.KindCorrection },
+		{ ID: 4, UpdatedTimestamp: 100, Updates: set(map[string]string{ "a": "1" }) },
+	}
+
+	results, err := s.ApplyTransaction(ctx, writes, UpdateOptions{})
+	if !errors.Is(err, ErrRecordDoesNotExist) || !strings.Contains(err.Error(), "write 2 to record 3") {
+		t.Fatalf("expected write 2 to fail with ErrRecordDoesNotExist, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("expected the results to end with the failing write, got %d results", len(results))
+	}
+
+	for _, id := range []int{ 1, 3, 4 } {
+		if _, err := s.GetRecord(ctx, id); !errors.Is(err, ErrRecordDoesNotExist) {
+			t.Errorf("expected record %d not to exist, got %v", id, err)
+		}
+	}
+
+	versions, err := s.GetVersions(ctx, 2)
+	if err != nil {
+		t.Fatalf("could not read the versions: %v", err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("expected the update to record 2 to be rolled back, got %d versions", len(versions))
+	}
+	expectData(t, "record 2", versions[0].Data, map[string]string{ "a": "1" })
+
+	verification, err := s.VerifyRecord(ctx, 2)
+	if err != nil {
+		t.Fatalf("could not verify the record: %v", err)
+	}
+	if !verification.Valid || !verification.Signed {
+		t.Errorf("expected the signed head to be rolled back with the write, got %+v", verification)
+	}
+
+	// The same writes without the failing one are all applied.
+	if _, err := s.ApplyTransaction(ctx, append(writes[:2:2], writes[3]), UpdateOptions{}); err != nil {
+		t.Fatalf("could not apply the transaction: %v", err)
+	}
+	for _, id := range []int{ 1, 2, 4 } {
+		if _, err := s.GetRecord(ctx, id); err != nil {
+			t.Errorf("expected record %d to be written, got %v", id, err)
+		}
+	}
+}